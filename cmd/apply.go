@@ -1,9 +1,10 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/spf13/cobra"
 
-	"github.com/moonwalker/comet/internal/log"
 	"github.com/moonwalker/comet/internal/schema"
 )
 
@@ -17,14 +18,26 @@ var (
 )
 
 func init() {
+	applyCmd.Flags().BoolVar(&allowProtected, "allow-protected", false, "Apply plans that delete or replace resources of protected components")
+	addSelectorFlag(applyCmd)
 	rootCmd.AddCommand(applyCmd)
 }
 
 func apply(cmd *cobra.Command, args []string) {
-	run(args, false, func(component *schema.Component, executor schema.Executor) {
-		err := executor.Apply(component)
+	run(args, "apply", func(component *schema.Component, executor schema.Executor) error {
+		if !component.Protect || allowProtected {
+			return executor.Apply(component)
+		}
+
+		// protected components apply the plan that was checked
+		destructive, err := planDestructive(component, executor)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
+		if len(destructive) > 0 {
+			return fmt.Errorf(errProtectedPlan, component.Name, addresses(destructive))
+		}
+
+		return executor.ApplyPlan(component)
 	})
 }
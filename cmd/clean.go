@@ -9,7 +9,9 @@ import (
 	"github.com/bmatcuk/doublestar/v4"
 	"github.com/spf13/cobra"
 
+	"github.com/moonwalker/comet/internal/exec/tf"
 	"github.com/moonwalker/comet/internal/log"
+	"github.com/moonwalker/comet/internal/modules"
 )
 
 const (
@@ -17,11 +19,11 @@ const (
 )
 
 var (
-	tffiles  = []string{"backend.tf.json", ".terraform", "terraform.tfstate.d", ".terraform.lock.hcl"}
+	tffiles  = []string{"backend.tf.json", "providers_gen.tf.json", "providers_gen.tf", "versions_gen_override.tf.json", ".terraform", "terraform.tfstate.d", ".terraform.lock.hcl"}
 	cleanCmd = &cobra.Command{
 		Use:   "clean <stack> [component]",
 		Short: cleanShort,
-		Long:  cleanShort + "\n\nincluding:\n\n" + strings.Join(tffiles, "\n"),
+		Long:  cleanShort + "\n\nincluding:\n\n" + strings.Join(tffiles, "\n") + "\nfiles written by generate()",
 		RunE:  clean,
 		Args:  cobra.RangeArgs(1, 2),
 	}
@@ -37,6 +39,14 @@ func clean(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// files written by generate() are listed in a manifest per component
+	err = doublestar.GlobWalk(os.DirFS(dir), "**/"+modules.GeneratedManifest, func(p string, d fs.DirEntry) error {
+		return tf.RemoveGenerated(filepath.Join(dir, filepath.Dir(p)))
+	})
+	if err != nil {
+		return err
+	}
+
 	globpattern := "**/{" + strings.Join(tffiles, ",") + "}"
 	return doublestar.GlobWalk(os.DirFS(dir), globpattern, func(p string, d fs.DirEntry) error {
 		path := filepath.Join(dir, p)
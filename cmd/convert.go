@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/moonwalker/comet/internal/convert"
+	"github.com/moonwalker/comet/internal/log"
+)
+
+var (
+	convertOut   string
+	convertForce bool
+
+	convertCmd = &cobra.Command{
+		Use:   "convert",
+		Short: "Convert configuration from other tools to stack files",
+	}
+
+	convertTerragruntCmd = &cobra.Command{
+		Use:   "terragrunt <dir>",
+		Short: "Convert a terragrunt repository to stack files",
+		Long: `Convert the terragrunt.hcl files below dir to one stack file per environment.
+
+Units are expected at <dir>/<env>/<component>/terragrunt.hcl, terragrunt.hcl
+files directly in <dir> are only read through include blocks.
+
+Converts:
+- terraform.source to the component source
+- inputs, merged with the inputs of included files
+- remote_state to backend()
+- dependency outputs to state references
+- generate "provider" blocks to component providers
+- prevent_destroy to protect
+
+Anything else is marked with a TODO comment in the generated files.`,
+		RunE: convertTerragrunt,
+		Args: cobra.ExactArgs(1),
+	}
+)
+
+func init() {
+	convertTerragruntCmd.Flags().StringVarP(&convertOut, "out", "o", "", "Output directory (default: stacks directory)")
+	convertTerragruntCmd.Flags().BoolVarP(&convertForce, "force", "f", false, "Overwrite existing stack files")
+
+	rootCmd.AddCommand(convertCmd)
+	convertCmd.AddCommand(convertTerragruntCmd)
+}
+
+func convertTerragrunt(cmd *cobra.Command, args []string) error {
+	files, err := convert.Terragrunt(args[0])
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no terragrunt units found in %s", args[0])
+	}
+
+	out := convertOut
+	if len(out) == 0 {
+		out = config.StacksDir
+	}
+
+	err = os.MkdirAll(out, 0755)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		path := filepath.Join(out, f.Stack+".stack.js")
+		if _, err := os.Stat(path); err == nil && !convertForce {
+			return fmt.Errorf("%s already exists, use --force to overwrite", path)
+		}
+	}
+
+	for _, f := range files {
+		path := filepath.Join(out, f.Stack+".stack.js")
+		err = os.WriteFile(path, f.Content, 0644)
+		if err != nil {
+			return err
+		}
+
+		if f.Todos > 0 {
+			log.Warn("stack converted with TODOs", "file", path, "todos", f.Todos)
+		} else {
+			log.Info("stack converted", "file", path)
+		}
+	}
+
+	return nil
+}
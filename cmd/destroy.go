@@ -3,7 +3,6 @@ package cmd
 import (
 	"github.com/spf13/cobra"
 
-	"github.com/moonwalker/comet/internal/log"
 	"github.com/moonwalker/comet/internal/schema"
 )
 
@@ -17,14 +16,13 @@ var (
 )
 
 func init() {
+	destroyCmd.Flags().BoolVar(&allowProtected, "allow-protected", false, "Destroy protected components")
+	addSelectorFlag(destroyCmd)
 	rootCmd.AddCommand(destroyCmd)
 }
 
 func destroy(cmd *cobra.Command, args []string) {
-	run(args, true, func(component *schema.Component, executor schema.Executor) {
-		err := executor.Destroy(component)
-		if err != nil {
-			log.Fatal(err)
-		}
+	run(args, "destroy", func(component *schema.Component, executor schema.Executor) error {
+		return executor.Destroy(component)
 	})
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/moonwalker/comet/internal/exec/tf"
 	"github.com/moonwalker/comet/internal/log"
 	"github.com/moonwalker/comet/internal/schema"
 )
@@ -32,27 +33,37 @@ The exported directory will contain all generated .tf and .tfvars files.`,
 
 func init() {
 	exportCmd.Flags().StringVarP(&exportDir, "output", "o", "./exported", "Output directory for exported files")
+	addSelectorFlag(exportCmd)
 	rootCmd.AddCommand(exportCmd)
 }
 
 func export_stack(cmd *cobra.Command, args []string) {
 	log.Info(fmt.Sprintf("Exporting stack '%s' to '%s'", args[0], exportDir))
 
-	run(args, false, func(component *schema.Component, executor schema.Executor) {
+	run(args, "export", func(component *schema.Component, executor schema.Executor) error {
 		// Create export directory structure
 		componentExportDir := filepath.Join(exportDir, args[0], component.Name)
 		err := os.MkdirAll(componentExportDir, 0755)
 		if err != nil {
-			log.Fatal(fmt.Errorf("failed to create export directory: %w", err))
+			return fmt.Errorf("failed to create export directory: %w", err)
 		}
 
 		// Copy generated files to export directory
 		files := []string{
 			"backend.tf.json",
+			"providers_gen.tf.json",
 			"providers_gen.tf",
+			"versions_gen_override.tf.json",
 			fmt.Sprintf("%s-%s.tfvars.json", args[0], component.Name),
 		}
 
+		// files written by generate()
+		generated, err := tf.GeneratedFiles(component.Path)
+		if err != nil {
+			return err
+		}
+		files = append(files, generated...)
+
 		for _, file := range files {
 			srcPath := filepath.Join(component.Path, file)
 			dstPath := filepath.Join(componentExportDir, file)
@@ -69,10 +80,14 @@ func export_stack(cmd *cobra.Command, args []string) {
 				continue
 			}
 
-			// Write to destination
+			// Write to destination, generated files can be in subdirectories
+			err = os.MkdirAll(filepath.Dir(dstPath), 0755)
+			if err != nil {
+				return fmt.Errorf("failed to create directory for %s: %w", file, err)
+			}
 			err = os.WriteFile(dstPath, content, 0644)
 			if err != nil {
-				log.Fatal(fmt.Errorf("failed to write %s: %w", file, err))
+				return fmt.Errorf("failed to write %s: %w", file, err)
 			}
 
 			log.Info(fmt.Sprintf("Exported %s", file))
@@ -110,8 +125,10 @@ terraform apply -var-file=%s-%s.tfvars.json
 ## Files
 
 - `+"`backend.tf.json`"+` - Backend configuration
-- `+"`providers_gen.tf`"+` - Provider configurations
+- `+"`providers_gen.tf.json`"+` - Provider configurations
+- `+"`versions_gen_override.tf.json`"+` - Required tofu and provider versions
 - `+"`%s-%s.tfvars.json`"+` - Variable values
+- Files written by `+"`generate()`"+`, if any
 
 ## Notes
 
@@ -132,6 +149,7 @@ stack files instead.
 		}
 
 		log.Info(fmt.Sprintf("✓ Exported component '%s' to %s", component.Name, componentExportDir))
+		return nil
 	})
 
 	log.Info(fmt.Sprintf("✓ Export complete: %s", exportDir))
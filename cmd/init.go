@@ -3,7 +3,6 @@ package cmd
 import (
 	"github.com/spf13/cobra"
 
-	"github.com/moonwalker/comet/internal/log"
 	"github.com/moonwalker/comet/internal/schema"
 )
 
@@ -21,14 +20,12 @@ Useful for read-only operations like 'comet output' or troubleshooting.`,
 )
 
 func init() {
+	addSelectorFlag(initCmd)
 	rootCmd.AddCommand(initCmd)
 }
 
 func initialize(cmd *cobra.Command, args []string) {
-	run(args, false, func(component *schema.Component, executor schema.Executor) {
-		err := executor.Init(component)
-		if err != nil {
-			log.Fatal(err)
-		}
+	run(args, "init", func(component *schema.Component, executor schema.Executor) error {
+		return executor.Init(component)
 	})
 }
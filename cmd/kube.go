@@ -32,7 +32,7 @@ func kubeconfig(cmd *cobra.Command, args []string) error {
 		log.Fatal(err)
 	}
 
-	stacks, err := parser.LoadStacks(config.StacksDir)
+	stacks, err := parser.LoadStack(config.StacksDir, args[0])
 	if err != nil {
 		return err
 	}
@@ -6,6 +6,7 @@ import (
 	"github.com/moonwalker/comet/internal/cli"
 	"github.com/moonwalker/comet/internal/log"
 	"github.com/moonwalker/comet/internal/parser"
+	"github.com/moonwalker/comet/internal/schema"
 )
 
 var (
@@ -23,25 +24,37 @@ var (
 func init() {
 	rootCmd.AddCommand(listCmd)
 	listCmd.Flags().BoolVarP(&listDetails, "details", "d", false, "Show full metadata details")
+	addSelectorFlag(listCmd)
 }
 
 func list(cmd *cobra.Command, args []string) error {
-	stacks, err := parser.LoadStacks(config.StacksDir)
-	if err != nil {
-		return err
-	}
-
 	if len(args) == 0 {
+		stacks, err := parser.LoadStacks(config.StacksDir)
+		if err != nil {
+			return err
+		}
+
 		cli.PrintStacksList(stacks, listDetails)
 		return nil
 	}
 
+	// only the named stack, so broken unrelated stack files don't block it
+	stacks, err := parser.LoadStack(config.StacksDir, args[0])
+	if err != nil {
+		return err
+	}
+
 	stack, err := stacks.GetStack(args[0])
 	if stack == nil {
 		return err
 	}
 
-	comps := stack.Components
+	sel, err := schema.ParseSelector(selector)
+	if err != nil {
+		return err
+	}
+
+	comps := sel.Select(stack.Components)
 	if len(comps) == 0 {
 		log.Info("no components found")
 		return nil
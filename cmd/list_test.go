@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListStackWithBrokenSibling(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	stacksDir := config.StacksDir
+	config.StacksDir = "stacks"
+	t.Cleanup(func() { config.StacksDir = stacksDir })
+
+	os.MkdirAll("stacks", 0755)
+	os.WriteFile(filepath.Join("stacks", "dev.stack.js"), []byte("stack('dev', {})\ncomponent('vpc', 'modules/vpc', {})\n"), 0644)
+	os.WriteFile(filepath.Join("stacks", "broken.stack.js"), []byte("stack('broken', {"), 0644)
+
+	if err := list(listCmd, []string{"dev"}); err != nil {
+		t.Errorf("list dev error = %v", err)
+	}
+	if err := list(listCmd, nil); err == nil {
+		t.Error("list of all stacks error = nil, want the broken file")
+	}
+}
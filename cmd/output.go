@@ -6,7 +6,6 @@ import (
 
 	"github.com/spf13/cobra"
 
-	"github.com/moonwalker/comet/internal/log"
 	"github.com/moonwalker/comet/internal/schema"
 )
 
@@ -30,6 +29,7 @@ The --json flag formats the output as JSON, which can be piped to tools like jq.
 
 func init() {
 	outputCmd.Flags().BoolVar(&outputJSON, "json", false, "Output in JSON format")
+	addSelectorFlag(outputCmd)
 	rootCmd.AddCommand(outputCmd)
 }
 
@@ -42,10 +42,10 @@ func output(cmd *cobra.Command, args []string) {
 		args = args[:2]
 	}
 
-	run(args, false, func(component *schema.Component, executor schema.Executor) {
+	run(args, "output", func(component *schema.Component, executor schema.Executor) error {
 		out, err := executor.Output(component)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		// JSON output mode
@@ -63,9 +63,9 @@ func output(cmd *cobra.Command, args []string) {
 						fmt.Println(string(jsonBytes))
 					}
 				} else {
-					log.Fatal(fmt.Errorf("output key '%s' not found in component '%s'", keyFilter, component.Name))
+					return fmt.Errorf("output key '%s' not found in component '%s'", keyFilter, component.Name)
 				}
-				return
+				return nil
 			}
 
 			// Output all values as JSON object
@@ -80,7 +80,7 @@ func output(cmd *cobra.Command, args []string) {
 			}
 			jsonBytes, _ := json.MarshalIndent(result, "", "  ")
 			fmt.Println(string(jsonBytes))
-			return
+			return nil
 		}
 
 		// Plain text output mode
@@ -102,9 +102,9 @@ func output(cmd *cobra.Command, args []string) {
 					fmt.Println(v.String())
 				}
 			} else {
-				log.Fatal(fmt.Errorf("output key '%s' not found in component '%s'", keyFilter, component.Name))
+				return fmt.Errorf("output key '%s' not found in component '%s'", keyFilter, component.Name)
 			}
-			return
+			return nil
 		}
 
 		// Show all outputs in human-readable format
@@ -133,5 +133,7 @@ func output(cmd *cobra.Command, args []string) {
 				fmt.Printf("%s = \"%s\"\n", k, v.String())
 			}
 		}
+
+		return nil
 	})
 }
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/spf13/cobra"
 
 	"github.com/moonwalker/comet/internal/log"
@@ -17,14 +19,25 @@ var (
 )
 
 func init() {
+	addSelectorFlag(planCmd)
 	rootCmd.AddCommand(planCmd)
 }
 
 func plan(cmd *cobra.Command, args []string) {
-	run(args, false, func(component *schema.Component, executor schema.Executor) {
-		_, err := executor.Plan(component)
+	run(args, "plan", func(component *schema.Component, executor schema.Executor) error {
+		if !component.Protect {
+			_, err := executor.Plan(component)
+			return err
+		}
+
+		destructive, err := planDestructive(component, executor)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
+		if len(destructive) > 0 {
+			log.Warn(fmt.Sprintf("⚠️  plan deletes or replaces resources of protected component %s: %s", component.Name, addresses(destructive)))
+		}
+
+		return nil
 	})
 }
@@ -3,7 +3,6 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -12,6 +11,7 @@ import (
 	"github.com/moonwalker/comet/internal/env"
 	"github.com/moonwalker/comet/internal/log"
 	"github.com/moonwalker/comet/internal/schema"
+	"github.com/moonwalker/comet/internal/secrets"
 )
 
 const (
@@ -55,8 +55,8 @@ func loadConfigEnv(config *schema.Config) {
 
 		// Only plain values supported
 		// For secrets, use 'comet bootstrap' to set them up locally
-		if strings.HasPrefix(value, "op://") || strings.HasPrefix(value, "sops://") {
-			log.Error(fmt.Sprintf("Secret references (op://, sops://) are no longer supported in env section for %s", key))
+		if secrets.IsRef(value) {
+			log.Error(fmt.Sprintf("Secret references (op://, sops://, vault://, ...) are no longer supported in env section for %s", key))
 			log.Error(fmt.Sprintf("Use 'comet bootstrap' to set up secrets locally. See docs for migration guide."))
 			continue
 		}
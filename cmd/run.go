@@ -1,7 +1,12 @@
 package cmd
 
 import (
+	"fmt"
 	"slices"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/spf13/cobra"
 
 	"github.com/moonwalker/comet/internal/exec"
 	"github.com/moonwalker/comet/internal/log"
@@ -9,13 +14,29 @@ import (
 	"github.com/moonwalker/comet/internal/schema"
 )
 
-func run(args []string, reverse bool, cb func(*schema.Component, schema.Executor)) {
+const (
+	errProtected     = "refusing to destroy protected components: %s (use --allow-protected to override)"
+	errProtectedPlan = "refusing to apply: plan deletes or replaces resources of protected component %s: %s (use --allow-protected to override)"
+	errDisabledRef   = "component %s references disabled component %s/%s"
+)
+
+var (
+	allowProtected bool
+	selector       string
+)
+
+// addSelectorFlag lets a command filter components by their labels
+func addSelectorFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "Filter components by labels (e.g. tier=network,team!=data)")
+}
+
+func run(args []string, op string, cb func(*schema.Component, schema.Executor) error) {
 	executor, err := exec.GetExecutor(config)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	stacks, err := parser.LoadStacks(config.StacksDir)
+	stacks, err := parser.LoadStack(config.StacksDir, args[0])
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -39,22 +60,260 @@ func run(args []string, reverse bool, cb func(*schema.Component, schema.Executor
 		log.Fatal(err)
 	}
 
+	sel, err := schema.ParseSelector(selector)
+	if err != nil {
+		log.Fatal(err)
+	}
+	components = sel.Select(components)
+
+	// disabled components are skipped, destroy can still target them by name
+	components = enabledComponents(components, op, len(componentNames) > 0, executor)
+	if len(components) == 0 {
+		log.Info("no components to run")
+		return
+	}
+
+	err = checkDisabledRefs(stacks, components)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// stack protection, versions and generated files apply to all of its components
+	for _, component := range components {
+		component.Protect = stack.Protects(component)
+		component.Versions = stack.Versions.Merge(component.Versions)
+		component.Generate = stack.Generates(component)
+	}
+
+	// refuse before anything runs with a tf command outside the constraints
+	err = checkTofu(components, executor)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// refuse before anything is destroyed
+	if op == "destroy" && !allowProtected {
+		err = checkProtected(components)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// reverse components order, in case of destroy
-	if reverse {
+	if op == "destroy" {
 		slices.Reverse(components)
 	}
 
+	// stack hooks run once around all components
+	err = stack.Hooks.Run(&schema.HookContext{Event: "before_" + op, Operation: op, Stack: stack.Name})
+	if err != nil {
+		fail(stack, nil, op, executor, err)
+	}
+
 	for _, component := range components {
-		err := component.EnsurePath(config, true)
+		err := runComponent(component, op, stacks, executor, cb)
 		if err != nil {
-			log.Fatal(err)
+			fail(stack, component, op, executor, err)
+		}
+	}
+
+	err = stack.Hooks.Run(&schema.HookContext{Event: "after_" + op, Operation: op, Stack: stack.Name})
+	if err != nil {
+		fail(stack, nil, op, executor, err)
+	}
+
+	// inputs from mock outputs won't match what apply resolves
+	for _, c := range components {
+		if len(c.Mocked) > 0 {
+			log.Warn(fmt.Sprintf("⚠️  %s: %s used mock outputs in %s", c.Name, op, strings.Join(c.Mocked, ", ")))
+		}
+	}
+}
+
+func runComponent(component *schema.Component, op string, stacks *schema.Stacks, executor schema.Executor, cb func(*schema.Component, schema.Executor) error) error {
+	err := component.EnsurePath(config, true)
+	if err != nil {
+		return err
+	}
+
+	err = component.ResolveVars(config, stacks, executor, op)
+	if err != nil {
+		return err
+	}
+
+	err = component.Hooks.Run(hookContext(component, "before_"+op, op, executor))
+	if err != nil {
+		return err
+	}
+
+	err = cb(component, executor)
+	if err != nil {
+		return err
+	}
+
+	return component.Hooks.Run(hookContext(component, "after_"+op, op, executor))
+}
+
+func enabledComponents(components []*schema.Component, op string, named bool, executor schema.Executor) []*schema.Component {
+	res := make([]*schema.Component, 0, len(components))
+	for _, c := range components {
+		if !c.Disabled || (op == "destroy" && named) {
+			res = append(res, c)
+			continue
 		}
 
-		err = component.ResolveVars(config, stacks, executor)
+		log.Info(fmt.Sprintf("⏭️  %s: disabled (skip)", c.Name))
+		if op == "plan" || op == "apply" {
+			warnDisabledState(c, executor)
+		}
+	}
+	return res
+}
+
+// warnDisabledState warns when a disabled component still manages resources,
+// since they are left behind rather than destroyed
+func warnDisabledState(c *schema.Component, executor schema.Executor) {
+	err := c.EnsurePath(config, false)
+	if err != nil {
+		return
+	}
+
+	outputs, err := executor.Output(c)
+	if err != nil || len(outputs) == 0 {
+		log.Debug("no state for disabled component", "component", c.Name, "error", err)
+		return
+	}
+
+	log.Warn(fmt.Sprintf("⚠️  component %s is disabled but still has state, destroy it with: comet destroy %s %s", c.Name, c.Stack, c.Name))
+}
+
+// checkDisabledRefs fails when a component reads outputs of a disabled one
+func checkDisabledRefs(stacks *schema.Stacks, components []*schema.Component) error {
+	for _, c := range components {
+		if c.Disabled {
+			continue
+		}
+		for _, dep := range c.Depends {
+			ref, err := stacks.GetStack(dep.Stack)
+			if err != nil {
+				continue
+			}
+			refComponent, err := ref.GetComponent(dep.Component)
+			if err == nil && refComponent.Disabled {
+				return fmt.Errorf(errDisabledRef, c.Name, dep.Stack, dep.Component)
+			}
+		}
+	}
+	return nil
+}
+
+// checkTofu checks the version of the tf command against the tofu
+// constraints of the components, it is only looked up when there is one
+func checkTofu(components []*schema.Component, executor schema.Executor) error {
+	var v *version.Version
+	for _, c := range components {
+		if c.Versions == nil || len(c.Versions.Tofu) == 0 {
+			continue
+		}
+
+		if v == nil {
+			var err error
+			v, err = executor.Version()
+			if err != nil {
+				return err
+			}
+		}
+
+		err := c.CheckTofu(config.Command, v)
 		if err != nil {
-			log.Fatal(err)
+			return err
+		}
+	}
+	return nil
+}
+
+func checkProtected(components []*schema.Component) error {
+	var names []string
+	for _, c := range components {
+		if c.Protect {
+			names = append(names, c.Name)
+		}
+	}
+	if len(names) > 0 {
+		return fmt.Errorf(errProtected, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// planDestructive plans a component and returns the changes that would
+// delete or replace resources
+func planDestructive(component *schema.Component, executor schema.Executor) ([]*schema.ResourceChange, error) {
+	_, err := executor.Plan(component)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := executor.Changes(component)
+	if err != nil {
+		return nil, err
+	}
+
+	return schema.Destructive(changes), nil
+}
+
+func addresses(changes []*schema.ResourceChange) string {
+	res := make([]string, 0, len(changes))
+	for _, c := range changes {
+		res = append(res, c.Address)
+	}
+	return strings.Join(res, ", ")
+}
+
+// fail runs the on_error hooks of the component and the stack, then exits
+func fail(stack *schema.Stack, component *schema.Component, op string, executor schema.Executor, err error) {
+	ctx := &schema.HookContext{Event: schema.HookOnError, Operation: op, Stack: stack.Name, Error: err.Error()}
+
+	if component != nil {
+		ctx = hookContext(component, schema.HookOnError, op, executor)
+		ctx.Error = err.Error()
+
+		if herr := component.Hooks.Run(ctx); herr != nil {
+			log.Error("on_error hook failed", "error", herr)
 		}
+	}
+
+	if herr := stack.Hooks.Run(ctx); herr != nil {
+		log.Error("on_error hook failed", "error", herr)
+	}
+
+	log.Fatal(err)
+}
+
+// hookContext describes the component to its hooks, including its current
+// outputs, which are only read when there is a hook to run
+func hookContext(component *schema.Component, event, op string, executor schema.Executor) *schema.HookContext {
+	ctx := &schema.HookContext{
+		Event:     event,
+		Operation: op,
+		Stack:     component.Stack,
+		Component: component.Name,
+		Path:      component.Path,
+	}
+
+	if !component.Hooks.Has(event) {
+		return ctx
+	}
 
-		cb(component, executor)
+	outputs, err := executor.Output(component)
+	if err != nil {
+		log.Debug("no outputs for hook", "component", component.Name, "error", err)
+		return ctx
 	}
+
+	ctx.Outputs = make(map[string]string, len(outputs))
+	for k, v := range outputs {
+		ctx.Outputs[k] = v.String()
+	}
+
+	return ctx
 }
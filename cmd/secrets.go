@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/moonwalker/comet/internal/secrets"
+)
+
+var (
+	ageRecipients []string
+	ageArmor      bool
+	ageOut        string
+
+	secretsCmd = &cobra.Command{
+		Use:   "secrets",
+		Short: "Work with secret files",
+	}
+
+	secretsEncryptAgeCmd = &cobra.Command{
+		Use:   "encrypt-age",
+		Short: "Encrypt stdin to an age file for age:// references",
+		Long: `Encrypt stdin to an age file, to reference it as age://path/to/file.age
+or age://path/to/file.age#json/path for a value of a JSON file.
+
+Without --recipient the file is encrypted for the identities comet decrypts
+with: SOPS_AGE_KEY, SOPS_AGE_KEY_FILE and the key file written by bootstrap.
+
+Example:
+  echo -n "s3cret" | comet secrets encrypt-age -o secrets/token.age`,
+		RunE: secretsEncryptAge,
+		Args: cobra.NoArgs,
+	}
+)
+
+func init() {
+	secretsEncryptAgeCmd.Flags().StringArrayVarP(&ageRecipients, "recipient", "r", nil, "Encrypt for an age public key, can be repeated")
+	secretsEncryptAgeCmd.Flags().BoolVarP(&ageArmor, "armor", "a", false, "Write the armored text format")
+	secretsEncryptAgeCmd.Flags().StringVarP(&ageOut, "output", "o", "", "Output file (default: stdout)")
+
+	rootCmd.AddCommand(secretsCmd)
+	secretsCmd.AddCommand(secretsEncryptAgeCmd)
+}
+
+func secretsEncryptAge(cmd *cobra.Command, args []string) error {
+	var w io.Writer = os.Stdout
+	if len(ageOut) > 0 {
+		f, err := os.OpenFile(ageOut, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return secrets.AgeEncrypt(w, os.Stdin, ageRecipients, ageArmor)
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/moonwalker/comet/internal/log"
+	"github.com/moonwalker/comet/internal/validate"
+)
+
+var (
+	validateJSON bool
+
+	validateCmd = &cobra.Command{
+		Use:   "validate [stack...]",
+		Short: "Check stacks for errors without running tofu",
+		Long: `Check stacks for errors without running tofu or touching any backend.
+
+Checks that:
+- every stack file parses
+- every stack has a backend
+- component paths exist
+- component names are unique within a stack
+- state references point to existing stacks and components
+- there are no dependency cycles
+- kubeconfig has valid cluster entries
+
+With stack names, only the files of those stacks and the stacks they
+reference are reported.
+
+Exits with a non-zero status when errors are found, which makes it suitable for CI.
+The --json flag prints the diagnostics as JSON.`,
+		Run: validateStacks,
+	}
+)
+
+func init() {
+	validateCmd.Flags().BoolVar(&validateJSON, "json", false, "Output diagnostics in JSON format")
+	rootCmd.AddCommand(validateCmd)
+}
+
+func validateStacks(cmd *cobra.Command, args []string) {
+	diagnostics, err := validate.Run(config.StacksDir, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	errors, warnings := 0, 0
+	for _, d := range diagnostics {
+		if d.Severity == validate.SeverityError {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+
+	if validateJSON {
+		if diagnostics == nil {
+			diagnostics = []*validate.Diagnostic{}
+		}
+		jsonBytes, _ := json.MarshalIndent(map[string]interface{}{
+			"diagnostics": diagnostics,
+			"errors":      errors,
+			"warnings":    warnings,
+		}, "", "  ")
+		fmt.Println(string(jsonBytes))
+	} else {
+		for _, d := range diagnostics {
+			fmt.Println(d)
+		}
+		fmt.Printf("%d error(s), %d warning(s)\n", errors, warnings)
+	}
+
+	if validate.HasErrors(diagnostics) {
+		os.Exit(1)
+	}
+}
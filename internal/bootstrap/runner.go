@@ -160,7 +160,7 @@ func (r *Runner) runSecretStep(step *schema.BootstrapStep) error {
 	if targetPath == "" {
 		// Auto-detect default path for common secret types
 		if isSopsAgeKeySource(step.Source) {
-			targetPath = getDefaultSopsAgePath()
+			targetPath = secrets.AgeKeyPath()
 			log.Debug("Using default SOPS age key path", "path", targetPath)
 		} else {
 			return fmt.Errorf("target path is required for secret type: %s", step.Source)
@@ -340,26 +340,6 @@ func isSopsAgeKeySource(source string) bool {
 		(strings.Contains(lower, "age") || strings.Contains(lower, "key"))
 }
 
-// getDefaultSopsAgePath returns the default SOPS age key path for the current platform
-func getDefaultSopsAgePath() string {
-	// Check if XDG_CONFIG_HOME is set
-	if xdgConfigHome := os.Getenv("XDG_CONFIG_HOME"); xdgConfigHome != "" {
-		return filepath.Join(xdgConfigHome, "sops", "age", "keys.txt")
-	}
-
-	home, err := os.UserHomeDir()
-	if err != nil {
-		// Fallback to a reasonable default
-		return "~/.config/sops/age/keys.txt"
-	}
-
-	if runtime.GOOS == "darwin" {
-		return filepath.Join(home, "Library", "Application Support", "sops", "age", "keys.txt")
-	}
-
-	return filepath.Join(home, ".config", "sops", "age", "keys.txt")
-}
-
 // NeedsBootstrap checks if any bootstrap steps need to be run
 func NeedsBootstrap(config *schema.Config) bool {
 	if len(config.Bootstrap) == 0 {
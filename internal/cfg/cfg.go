@@ -3,6 +3,8 @@ package cfg
 import (
 	"errors"
 	"io/fs"
+	"os"
+	"strconv"
 
 	"github.com/spf13/viper"
 
@@ -17,6 +19,10 @@ func Read(cfgFile string, config *schema.Config) error {
 	viper.SetDefault("stacks_dir", "stacks")
 	viper.SetDefault("generate_backend", true)
 
+	// CI systems set CI=true, missing values should fail there
+	ci, _ := strconv.ParseBool(os.Getenv("CI"))
+	viper.SetDefault("strict_templates", ci)
+
 	viper.AutomaticEnv()
 
 	err := viper.ReadInConfig()
@@ -139,7 +139,19 @@ func PrintComponentsList(components []*schema.Component) {
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetAutoWrapText(false)
 
-	table.SetHeader([]string{"component", "path", "vars"})
+	hasDisabled := slices.ContainsFunc(components, func(c *schema.Component) bool { return c.Disabled })
+	hasLabels := slices.ContainsFunc(components, func(c *schema.Component) bool { return len(c.Labels) > 0 })
+
+	header := []string{"component"}
+	if hasDisabled {
+		header = append(header, "status")
+	}
+	if hasLabels {
+		header = append(header, "labels")
+	}
+	header = append(header, "path", "vars")
+
+	table.SetHeader(header)
 	slices.SortFunc(components, func(a, b *schema.Component) int {
 		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
 	})
@@ -150,7 +162,25 @@ func PrintComponentsList(components []*schema.Component) {
 			varsList = append(varsList, k+"="+fmt.Sprintf("%v", v))
 		}
 
-		table.Append([]string{c.Name, c.Path, strings.Join(varsList, "\n")})
+		row := []string{c.Name}
+		if hasDisabled {
+			status := "enabled"
+			if c.Disabled {
+				status = "disabled"
+			}
+			row = append(row, status)
+		}
+		if hasLabels {
+			labels := make([]string, 0, len(c.Labels))
+			for k, v := range c.Labels {
+				labels = append(labels, k+"="+v)
+			}
+			slices.Sort(labels)
+			row = append(row, strings.Join(labels, "\n"))
+		}
+		row = append(row, c.Path, strings.Join(varsList, "\n"))
+
+		table.Append(row)
 	}
 
 	table.Render()
@@ -0,0 +1,354 @@
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hcl/hcl/token"
+)
+
+var (
+	placeholderRe = regexp.MustCompile(`^__comet_expr_(\d+)__$`)
+)
+
+type (
+	// object is an HCL object or block body, keeping the order of its keys
+	object struct {
+		keys   []string
+		values map[string]any
+	}
+
+	// expr is an HCL2 expression the HCL1 parser can't read, like a
+	// reference or a function call
+	expr string
+)
+
+func newObject() *object {
+	return &object{values: map[string]any{}}
+}
+
+func (o *object) set(key string, v any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+func (o *object) get(key string) any {
+	if o == nil {
+		return nil
+	}
+	return o.values[key]
+}
+
+// parseHCL parses terragrunt configuration, which is HCL2, with the HCL1
+// parser: expressions HCL1 doesn't support are swapped for placeholder
+// strings first and restored as expr values
+func parseHCL(src string) (*ast.File, []string, error) {
+	rewritten, exprs := rewriteExprs(src)
+
+	f, err := parser.Parse([]byte(rewritten))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return f, exprs, nil
+}
+
+// decodeBody converts a list of attributes and blocks, blocks are keyed by
+// their type, followed by their labels: dependency "vpc" { } is stored
+// under dependency.vpc
+func decodeBody(list *ast.ObjectList, exprs []string) *object {
+	obj := newObject()
+
+	for _, item := range list.Items {
+		keys := make([]string, len(item.Keys))
+		for i, k := range item.Keys {
+			keys[i] = keyName(k)
+		}
+
+		target := obj
+		for _, k := range keys[:len(keys)-1] {
+			next, ok := target.get(k).(*object)
+			if !ok {
+				next = newObject()
+				target.set(k, next)
+			}
+			target = next
+		}
+		target.set(keys[len(keys)-1], decodeValue(item.Val, exprs))
+	}
+
+	return obj
+}
+
+func keyName(k *ast.ObjectKey) string {
+	if s, ok := k.Token.Value().(string); ok {
+		return s
+	}
+	return k.Token.Text
+}
+
+func decodeValue(node ast.Node, exprs []string) any {
+	switch n := node.(type) {
+	case *ast.ObjectType:
+		return decodeBody(n.List, exprs)
+	case *ast.ListType:
+		res := make([]any, len(n.List))
+		for i, e := range n.List {
+			res[i] = decodeValue(e, exprs)
+		}
+		return res
+	case *ast.LiteralType:
+		v := n.Token.Value()
+		if s, ok := v.(string); ok && n.Token.Type == token.STRING {
+			if m := placeholderRe.FindStringSubmatch(s); m != nil {
+				i, _ := strconv.Atoi(m[1])
+				return expr(exprs[i])
+			}
+		}
+		return v
+	}
+
+	return expr(fmt.Sprint(node))
+}
+
+// rewriteExprs replaces every value that is not a literal, a list or an
+// object with a placeholder string, returning the replaced expressions
+func rewriteExprs(src string) (string, []string) {
+	var (
+		sb     strings.Builder
+		exprs  []string
+		frames []byte // open brackets
+		expect bool   // a value starts at the next token
+	)
+
+	top := func() byte {
+		if len(frames) == 0 {
+			return '{'
+		}
+		return frames[len(frames)-1]
+	}
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		next := byte(0)
+		if i+1 < len(src) {
+			next = src[i+1]
+		}
+
+		switch {
+		case c == '#' || c == '/' && next == '/':
+			j := strings.IndexByte(src[i:], '\n')
+			if j < 0 {
+				j = len(src) - i
+			}
+			sb.WriteString(src[i : i+j])
+			i += j
+			continue
+		case c == '/' && next == '*':
+			j := strings.Index(src[i+2:], "*/")
+			end := len(src)
+			if j >= 0 {
+				end = i + 2 + j + 2
+			}
+			sb.WriteString(src[i:end])
+			i = end
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			sb.WriteByte(c)
+			i++
+			continue
+		case c == '<' && next == '<':
+			j := skipHeredoc(src, i)
+			sb.WriteString(src[i:j])
+			i, expect = j, false
+			continue
+		}
+
+		if expect {
+			literal := 0
+			switch {
+			case c == '[':
+				frames = append(frames, c)
+				sb.WriteByte(c)
+				i++
+				continue
+			case c == '{':
+				frames = append(frames, c)
+				sb.WriteByte(c)
+				i, expect = i+1, false
+				continue
+			case c == ']' || c == '}':
+				if len(frames) > 0 {
+					frames = frames[:len(frames)-1]
+				}
+				sb.WriteByte(c)
+				i, expect = i+1, false
+				continue
+			case c == '"':
+				literal = skipString(src, i)
+			case c >= '0' && c <= '9' || c == '-' && next >= '0' && next <= '9':
+				literal = skipNumber(src, i)
+			case strings.HasPrefix(src[i:], "true"):
+				literal = i + 4
+			case strings.HasPrefix(src[i:], "false"):
+				literal = i + 5
+			}
+
+			if literal > 0 && literalEnd(src, literal) {
+				sb.WriteString(src[i:literal])
+				i, expect = literal, false
+				continue
+			}
+
+			j := exprEnd(src, i)
+			sb.WriteString(fmt.Sprintf(`"__comet_expr_%d__"`, len(exprs)))
+			exprs = append(exprs, strings.TrimSpace(src[i:j]))
+			i, expect = j, false
+			continue
+		}
+
+		switch c {
+		case '"':
+			j := skipString(src, i)
+			sb.WriteString(src[i:j])
+			i = j
+			continue
+		case '=':
+			expect = true
+		case ',':
+			expect = top() == '['
+		case '{', '[':
+			frames = append(frames, c)
+			expect = c == '['
+		case '}', ']':
+			if len(frames) > 0 {
+				frames = frames[:len(frames)-1]
+			}
+		}
+
+		sb.WriteByte(c)
+		i++
+	}
+
+	return sb.String(), exprs
+}
+
+// literalEnd reports whether a value ends at i
+func literalEnd(src string, i int) bool {
+	for ; i < len(src); i++ {
+		switch src[i] {
+		case ' ', '\t', '\r':
+			continue
+		case '\n', ',', ']', '}', '#':
+			return true
+		case '/':
+			return i+1 < len(src) && (src[i+1] == '/' || src[i+1] == '*')
+		}
+		return false
+	}
+	return true
+}
+
+// exprEnd finds the end of the expression starting at i
+func exprEnd(src string, i int) int {
+	depth := 0
+	for j := i; j < len(src); j++ {
+		switch src[j] {
+		case '"':
+			j = skipString(src, j) - 1
+		case '<':
+			if j+1 < len(src) && src[j+1] == '<' {
+				j = skipHeredoc(src, j) - 1
+			}
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			if depth == 0 {
+				return j
+			}
+			depth--
+		case ',', '\n', '#':
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return len(src)
+}
+
+func skipNumber(src string, i int) int {
+	j := i + 1
+	for j < len(src) && strings.IndexByte("0123456789.eE+-", src[j]) >= 0 {
+		j++
+	}
+	return j
+}
+
+// skipString returns the index after the string starting at i, template
+// interpolations may contain nested strings
+func skipString(src string, i int) int {
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		case '\n':
+			return j
+		case '$', '%':
+			if j+1 < len(src) && src[j+1] == '{' {
+				j = skipInterpolation(src, j+2) - 1
+			}
+		}
+	}
+	return len(src)
+}
+
+// skipInterpolation returns the index after the } closing the template
+// interpolation whose content starts at i
+func skipInterpolation(src string, i int) int {
+	depth := 1
+	for j := i; j < len(src); j++ {
+		switch src[j] {
+		case '"':
+			j = skipString(src, j) - 1
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return len(src)
+}
+
+// skipHeredoc returns the index after the terminator line of the heredoc
+// starting at i, the newline is not included
+func skipHeredoc(src string, i int) int {
+	nl := strings.IndexByte(src[i:], '\n')
+	if nl < 0 {
+		return len(src)
+	}
+
+	marker := strings.TrimSpace(strings.TrimLeft(src[i+2:i+nl], "-~"))
+	j := i + nl + 1
+	for j < len(src) {
+		end := strings.IndexByte(src[j:], '\n')
+		if end < 0 {
+			end = len(src) - j
+		}
+		if strings.TrimSpace(src[j:j+end]) == marker {
+			return j + end
+		}
+		j += end + 1
+	}
+	return len(src)
+}
@@ -0,0 +1,696 @@
+package convert
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+
+	"github.com/moonwalker/comet/internal/log"
+)
+
+const (
+	terragruntFile = "terragrunt.hcl"
+)
+
+var (
+	dependencyRe = regexp.MustCompile(`^dependency\.([A-Za-z0-9_-]+)\.outputs((?:\.[A-Za-z0-9_-]+|\[\d+\]|\["[^"]+"\])+)$`)
+	pathPartRe   = regexp.MustCompile(`\.([A-Za-z0-9_-]+)|\[(\d+)\]|\["([^"]+)"\]`)
+	localRe      = regexp.MustCompile(`^local\.([A-Za-z0-9_-]+)$`)
+	getEnvRe     = regexp.MustCompile(`^get_env\(\s*"([A-Za-z_][A-Za-z0-9_]*)"\s*(?:,\s*"([^"]*)"\s*)?\)$`)
+	findParentRe = regexp.MustCompile(`^find_in_parent_folders\(\s*(?:"([^"]+)"\s*)?\)$`)
+	identRe      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	spaceRe      = regexp.MustCompile(`\s+`)
+
+	// provider blocks reference these directly, they are not terragrunt expressions
+	terraformRefs = []string{"var.", "local.", "data.", "module."}
+)
+
+type (
+	// File is a converted stack file
+	File struct {
+		Stack   string
+		Content []byte
+		Todos   int // constructs left for manual conversion
+	}
+
+	// unit is a directory with a terragrunt.hcl, converted to a component
+	unit struct {
+		dir       string
+		stack     string
+		name      string
+		body      *object // the unit's own configuration
+		includes  []*object
+		resolving map[string]bool
+		units     map[string]*unit
+		todos     []string
+	}
+
+	// todo is a value that could not be converted, keeping the original
+	todo string
+
+	// jsCode is a JS expression written as is
+	jsCode string
+)
+
+// Terragrunt converts the terragrunt units below dir into one stack per
+// environment: units are expected at dir/<env>/<component>/terragrunt.hcl,
+// deeper units are named after their path, e.g. us-east-1-vpc
+func Terragrunt(dir string) ([]*File, error) {
+	units := map[string]*unit{}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && (d.Name() == ".terragrunt-cache" || d.Name() == ".terraform") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || d.Name() != terragruntFile {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) < 2 {
+			// root configurations are only used through include
+			return nil
+		}
+
+		u, err := loadUnit(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		u.stack, u.name, u.units = parts[0], strings.Join(parts[1:], "-"), units
+		units[u.dir] = u
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stacks := map[string][]*unit{}
+	for _, u := range units {
+		stacks[u.stack] = append(stacks[u.stack], u)
+	}
+
+	names := make([]string, 0, len(stacks))
+	for name := range stacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := make([]*File, 0, len(names))
+	for _, name := range names {
+		f, err := writeStack(name, dir, order(stacks[name]))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+func loadUnit(dir string) (*unit, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := loadConfig(filepath.Join(abs, terragruntFile))
+	if err != nil {
+		return nil, err
+	}
+
+	u := &unit{dir: abs, body: body, resolving: map[string]bool{}}
+
+	for _, inc := range blocks(body, "include") {
+		path := u.includePath(inc.get("path"))
+		if len(path) == 0 {
+			u.todo("include: path %s", describe(inc.get("path")))
+			continue
+		}
+
+		parent, err := loadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		u.includes = append(u.includes, parent)
+
+		for _, key := range inc.keys {
+			if key != "path" {
+				u.todo("include: %s", key)
+			}
+		}
+	}
+
+	return u, nil
+}
+
+func loadConfig(path string) (*object, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, exprs, err := parseHCL(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return decodeBody(f.Node.(*ast.ObjectList), exprs), nil
+}
+
+// includePath resolves the path of an include block
+func (u *unit) includePath(v any) string {
+	switch p := v.(type) {
+	case string:
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(u.dir, p)
+		}
+		return p
+	case expr:
+		m := findParentRe.FindStringSubmatch(string(p))
+		if m == nil {
+			return ""
+		}
+		name := m[1]
+		if len(name) == 0 {
+			name = terragruntFile
+		}
+		for dir := filepath.Dir(u.dir); ; dir = filepath.Dir(dir) {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+			if dir == filepath.Dir(dir) {
+				return ""
+			}
+		}
+	}
+	return ""
+}
+
+// attr returns an attribute of the unit, falling back to its includes
+func (u *unit) attr(keys ...string) any {
+	for _, body := range append([]*object{u.body}, u.includes...) {
+		v := any(body)
+		for _, k := range keys {
+			obj, ok := v.(*object)
+			if !ok {
+				v = nil
+				break
+			}
+			v = obj.get(k)
+		}
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// local returns a local of the unit or of its includes
+func (u *unit) local(name string) any {
+	return u.attr("locals", name)
+}
+
+// inputs merges the inputs of the includes with the unit's own
+func (u *unit) inputs() any {
+	merged := newObject()
+	for i := len(u.includes) - 1; i >= -1; i-- {
+		body := u.body
+		if i >= 0 {
+			body = u.includes[i]
+		}
+
+		switch in := body.get("inputs").(type) {
+		case *object:
+			for _, k := range in.keys {
+				merged.set(k, in.values[k])
+			}
+		case nil:
+		default:
+			return in
+		}
+	}
+	return merged
+}
+
+func (u *unit) todo(format string, args ...any) {
+	u.todos = append(u.todos, fmt.Sprintf(format, args...))
+}
+
+// source converts terraform.source to a component path, local paths are
+// made relative to the working directory comet runs in
+func (u *unit) source() any {
+	v := u.value(u.attr("terraform", "source"))
+
+	src, ok := v.(string)
+	if !ok {
+		if v == nil {
+			u.todo("no terraform.source")
+			return "TODO"
+		}
+		return v
+	}
+
+	switch {
+	case strings.HasPrefix(src, "git::"), strings.HasPrefix(src, "git@"):
+		return src
+	case strings.Contains(src, "://"):
+		u.todo("terraform.source %s is not a git source", src)
+		return src
+	}
+
+	if !filepath.IsAbs(src) {
+		src = filepath.Join(u.dir, src)
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, src); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(src)
+}
+
+// providers converts the provider blocks of a generate "provider" block
+func (u *unit) providers() *object {
+	gen, ok := u.attr("generate", "provider").(*object)
+	if !ok {
+		return nil
+	}
+
+	contents, ok := u.value(gen.get("contents")).(string)
+	if !ok {
+		u.todo("generate provider: contents %s", describe(gen.get("contents")))
+		return nil
+	}
+
+	f, exprs, err := parseHCL(contents)
+	if err != nil {
+		u.todo("generate provider: %s", err)
+		return nil
+	}
+
+	providers := newObject()
+	for _, item := range f.Node.(*ast.ObjectList).Items {
+		if len(item.Keys) != 2 || keyName(item.Keys[0]) != "provider" {
+			u.todo("generate provider: %s block", keyName(item.Keys[0]))
+			continue
+		}
+
+		name := keyName(item.Keys[1])
+		if providers.get(name) != nil {
+			u.todo("generate provider: more than one %s provider", name)
+			continue
+		}
+
+		body, ok := decodeValue(item.Val, exprs).(*object)
+		if ok {
+			providers.set(name, u.providerValue(body))
+		}
+	}
+
+	return providers
+}
+
+// providerValue converts provider arguments, references to variables,
+// locals and data sources are kept as { expr } values written to the
+// provider block as they are
+func (u *unit) providerValue(v any) any {
+	switch t := v.(type) {
+	case expr:
+		for _, prefix := range terraformRefs {
+			if strings.HasPrefix(string(t), prefix) {
+				ref := newObject()
+				ref.set("expr", string(t))
+				return ref
+			}
+		}
+	case *object:
+		res := newObject()
+		for _, k := range t.keys {
+			res.set(k, u.providerValue(t.values[k]))
+		}
+		return res
+	}
+	return u.value(v)
+}
+
+// backend converts remote_state
+func (u *unit) backend() (string, *object) {
+	rs, ok := u.attr("remote_state").(*object)
+	if !ok {
+		return "", nil
+	}
+
+	for _, k := range rs.keys {
+		if k != "backend" && k != "config" && k != "generate" {
+			u.todo("remote_state: %s", k)
+		}
+	}
+
+	t, _ := u.value(rs.get("backend")).(string)
+	config, _ := u.value(rs.get("config")).(*object)
+	return t, config
+}
+
+// value converts a decoded HCL value, expressions that can't be
+// converted become todo values
+func (u *unit) value(v any) any {
+	switch t := v.(type) {
+	case expr:
+		return u.expr(string(t))
+	case string:
+		return u.template(t)
+	case []any:
+		res := make([]any, len(t))
+		for i, e := range t {
+			res[i] = u.value(e)
+		}
+		return res
+	case *object:
+		res := newObject()
+		for _, k := range t.keys {
+			res.set(k, u.value(t.values[k]))
+		}
+		return res
+	}
+	return v
+}
+
+// expr converts the expressions that have a comet equivalent
+func (u *unit) expr(e string) any {
+	e = spaceRe.ReplaceAllString(strings.TrimSpace(e), " ")
+
+	if m := dependencyRe.FindStringSubmatch(e); m != nil {
+		if ref, ok := u.stateRef(m[1], m[2]); ok {
+			return ref
+		}
+		return todo(e)
+	}
+
+	if m := localRe.FindStringSubmatch(e); m != nil {
+		name := m[1]
+		lv := u.local(name)
+		if lv == nil || u.resolving[name] {
+			return todo(e)
+		}
+		u.resolving[name] = true
+		defer delete(u.resolving, name)
+		return u.value(lv)
+	}
+
+	if m := getEnvRe.FindStringSubmatch(e); m != nil {
+		code := "env." + m[1]
+		if len(m[2]) > 0 {
+			code += " || " + jsString(m[2])
+		}
+		return jsCode(code)
+	}
+
+	switch e {
+	case "null":
+		return nil
+	case "path_relative_to_include()":
+		return "{{ .stack }}/{{ .component }}"
+	}
+
+	return todo(e)
+}
+
+// stateRef converts a dependency output reference to a state template
+func (u *unit) stateRef(name, path string) (string, bool) {
+	dep, ok := u.attr("dependency", name).(*object)
+	if !ok {
+		return "", false
+	}
+
+	configPath, ok := dep.get("config_path").(string)
+	if !ok {
+		return "", false
+	}
+	if !filepath.IsAbs(configPath) {
+		configPath = filepath.Join(u.dir, configPath)
+	}
+
+	target, ok := u.units[filepath.Clean(configPath)]
+	if !ok {
+		return "", false
+	}
+
+	ref := fmt.Sprintf(`(state "%s" "%s")`, target.stack, target.name)
+	for _, m := range pathPartRe.FindAllStringSubmatch(path, -1) {
+		switch {
+		case len(m[1]) > 0 && identRe.MatchString(m[1]):
+			ref += "." + m[1]
+		case len(m[1]) > 0:
+			ref = fmt.Sprintf("(index %s %s)", ref, strconv.Quote(m[1]))
+		case len(m[2]) > 0:
+			ref = fmt.Sprintf("(index %s %s)", ref, m[2])
+		default:
+			ref = fmt.Sprintf("(index %s %s)", ref, strconv.Quote(m[3]))
+		}
+	}
+
+	return "{{ " + ref + " }}", true
+}
+
+// template converts a string with interpolations, to a plain string when
+// all of them resolve to literals, or to a JS template literal
+func (u *unit) template(s string) any {
+	if strings.Contains(s, "%{") {
+		return todo(s)
+	}
+
+	var (
+		sb      strings.Builder // plain string
+		js      strings.Builder // JS template literal
+		hasCode bool
+	)
+
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], "$${") {
+			sb.WriteString("${")
+			js.WriteString(escapeTemplate("${"))
+			i += 3
+			continue
+		}
+		if !strings.HasPrefix(s[i:], "${") {
+			sb.WriteByte(s[i])
+			js.WriteString(escapeTemplate(s[i : i+1]))
+			i++
+			continue
+		}
+
+		end := skipInterpolation(s, i+2)
+		v := u.expr(s[i+2 : end-1])
+		switch t := v.(type) {
+		case jsCode:
+			hasCode = true
+			js.WriteString("${" + string(t) + "}")
+		case string, int64, float64, bool:
+			str := fmt.Sprint(t)
+			sb.WriteString(str)
+			js.WriteString(escapeTemplate(str))
+		default:
+			return todo(s)
+		}
+		i = end
+	}
+
+	if hasCode {
+		return jsCode("`" + js.String() + "`")
+	}
+	return sb.String()
+}
+
+func escapeTemplate(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "`", "\\`")
+	return strings.ReplaceAll(s, "${", "\\${")
+}
+
+// checkUnsupported records the configuration that has no comet equivalent
+func (u *unit) checkUnsupported() {
+	supported := []string{"terraform", "inputs", "remote_state", "dependency", "dependencies",
+		"generate", "include", "locals", "prevent_destroy"}
+
+	for _, body := range append([]*object{u.body}, u.includes...) {
+		for _, k := range body.keys {
+			if !slices.Contains(supported, k) {
+				u.todo("%s is not supported", k)
+			}
+		}
+	}
+
+	if tf, ok := u.attr("terraform").(*object); ok {
+		for _, k := range tf.keys {
+			if k != "source" {
+				u.todo("terraform.%s is not supported", k)
+			}
+		}
+	}
+
+	if gen, ok := u.attr("generate").(*object); ok {
+		for _, k := range gen.keys {
+			if k != "provider" {
+				u.todo("generate %q is not supported", k)
+			}
+		}
+	}
+
+	if deps, ok := u.attr("dependency").(*object); ok {
+		for _, name := range deps.keys {
+			dep, _ := deps.values[name].(*object)
+			for _, k := range dep.keys {
+				if k != "config_path" {
+					u.todo("dependency %q: %s is not supported", name, k)
+				}
+			}
+		}
+	}
+
+	if len(u.todos) > 0 {
+		log.Debug("terragrunt unit has unsupported configuration", "dir", u.dir, "todos", len(u.todos))
+	}
+}
+
+// order sorts the units of a stack so that dependencies come first, since
+// comet runs components in the order they are declared, units without an
+// order between them are sorted by name
+func order(units []*unit) []*unit {
+	sort.Slice(units, func(i, j int) bool { return units[i].name < units[j].name })
+
+	deps := make(map[*unit][]*unit, len(units))
+	for _, u := range units {
+		deps[u] = u.dependencies()
+	}
+
+	sorted := make([]*unit, 0, len(units))
+	done := make(map[*unit]bool, len(units))
+	for len(sorted) < len(units) {
+		next, first := -1, -1
+		for i, u := range units {
+			if done[u] {
+				continue
+			}
+			if first < 0 {
+				first = i
+			}
+			if ready(u, deps[u], done) {
+				next = i
+				break
+			}
+		}
+
+		if next < 0 {
+			// a cycle, break it at the first unit by name
+			next = first
+			units[next].todo("dependency cycle, check the order of the components")
+		}
+
+		done[units[next]] = true
+		sorted = append(sorted, units[next])
+	}
+
+	return sorted
+}
+
+// ready reports whether the dependencies of u in its stack are sorted
+func ready(u *unit, deps []*unit, done map[*unit]bool) bool {
+	for _, d := range deps {
+		if d.stack == u.stack && !done[d] {
+			return false
+		}
+	}
+	return true
+}
+
+// dependencies returns the units of the dependency blocks and of the
+// dependencies block, paths outside of the converted units are reported
+func (u *unit) dependencies() []*unit {
+	var paths []any
+	if deps, ok := u.attr("dependency").(*object); ok {
+		for _, name := range deps.keys {
+			if dep, ok := deps.values[name].(*object); ok {
+				paths = append(paths, dep.get("config_path"))
+			}
+		}
+	}
+	if deps, ok := u.attr("dependencies").(*object); ok {
+		switch list := deps.get("paths").(type) {
+		case []any:
+			paths = append(paths, list...)
+		default:
+			u.todo("dependencies: paths %s", describe(list))
+		}
+	}
+
+	var res []*unit
+	for _, p := range paths {
+		path, ok := p.(string)
+		if !ok {
+			u.todo("dependency path %s", describe(p))
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(u.dir, path)
+		}
+		target, ok := u.units[filepath.Clean(path)]
+		if !ok {
+			u.todo("dependency %s is not a converted unit", path)
+			continue
+		}
+		if target.stack != u.stack {
+			u.todo("dependency %s is in stack %s, run it first", target.name, target.stack)
+		}
+		res = append(res, target)
+	}
+	return res
+}
+
+// blocks returns the blocks of a type, with or without labels
+func blocks(body *object, name string) []*object {
+	v, ok := body.get(name).(*object)
+	if !ok {
+		return nil
+	}
+
+	if v.get("path") != nil {
+		return []*object{v}
+	}
+
+	var res []*object
+	for _, k := range v.keys {
+		if b, ok := v.values[k].(*object); ok {
+			res = append(res, b)
+		}
+	}
+	return res
+}
+
+// describe renders a value for a TODO comment
+func describe(v any) string {
+	switch t := v.(type) {
+	case expr:
+		return spaceRe.ReplaceAllString(string(t), " ")
+	case todo:
+		return spaceRe.ReplaceAllString(string(t), " ")
+	case nil:
+		return "missing"
+	}
+	return fmt.Sprint(v)
+}
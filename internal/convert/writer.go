@@ -0,0 +1,188 @@
+package convert
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type writer struct {
+	sb    strings.Builder
+	todos int
+}
+
+// writeStack renders the units of an environment as a stack file
+func writeStack(name, dir string, units []*unit) (*File, error) {
+	w := &writer{}
+
+	w.printf("// Converted from the terragrunt configuration in %s by comet convert.\n", dir)
+	w.printf("// Review the TODO comments, they mark what could not be converted.\n\n")
+	w.printf("stack(%s, {})\n\n", jsString(name))
+
+	var backendType, backendCode string
+	for _, u := range units {
+		u.checkUnsupported()
+
+		t, config := u.backend()
+		if len(t) == 0 {
+			continue
+		}
+
+		code := (&writer{}).value(config, "")
+		if len(backendType) == 0 {
+			backendType, backendCode = t, code
+			w.printf("backend(%s, %s)\n\n", jsString(t), w.value(config, ""))
+			continue
+		}
+		if t != backendType || code != backendCode {
+			u.todo("remote_state differs from the stack backend")
+		}
+	}
+	if len(backendType) == 0 {
+		w.comment("", "no remote_state found, add a backend()")
+		w.printf("\n")
+	}
+
+	for _, u := range units {
+		w.component(u)
+	}
+
+	content := strings.TrimRight(w.sb.String(), "\n") + "\n"
+	return &File{Stack: name, Content: []byte(content), Todos: w.todos}, nil
+}
+
+func (w *writer) component(u *unit) {
+	src := u.source()
+	if t, ok := src.(todo); ok {
+		u.todo("terraform.source %s", describe(t))
+		src = string(t)
+	}
+
+	inputs := u.value(u.inputs())
+	if t, ok := inputs.(todo); ok {
+		u.todo("inputs %s", describe(t))
+		inputs = newObject()
+	}
+
+	providers := u.providers()
+	protect, _ := u.attr("prevent_destroy").(bool)
+
+	// always the inputs form, so inputs named like comet options stay inputs
+	config := newObject()
+	config.set("inputs", inputs)
+	if providers != nil && len(providers.keys) > 0 {
+		config.set("providers", providers)
+	}
+	if protect {
+		config.set("protect", true)
+	}
+
+	for _, t := range u.todos {
+		w.comment("", t)
+	}
+	w.printf("component(%s, %s, %s)\n\n", jsString(u.name), w.value(src, ""), w.value(config, ""))
+}
+
+func (w *writer) printf(format string, args ...any) {
+	w.sb.WriteString(fmt.Sprintf(format, args...))
+}
+
+func (w *writer) comment(indent, msg string) {
+	w.todos++
+	w.printf("%s// TODO: %s\n", indent, msg)
+}
+
+// value renders a converted value as JS, values that could not be
+// converted are written as null with a TODO comment
+func (w *writer) value(v any, indent string) string {
+	code, comment := w.render(v, indent)
+	if len(comment) > 0 {
+		code += " /* " + comment + " */"
+	}
+	return code
+}
+
+func (w *writer) render(v any, indent string) (string, string) {
+	switch t := v.(type) {
+	case todo:
+		w.todos++
+		return "null", "TODO: " + describe(t)
+	case nil:
+		return "null", ""
+	case string:
+		return jsString(t), ""
+	case jsCode:
+		return string(t), ""
+	case bool:
+		return strconv.FormatBool(t), ""
+	case int64:
+		return strconv.FormatInt(t, 10), ""
+	case float64:
+		return strconv.FormatFloat(t, 'g', -1, 64), ""
+	case *object:
+		if t == nil || len(t.keys) == 0 {
+			return "{}", ""
+		}
+		lines := make([]string, len(t.keys))
+		for i, k := range t.keys {
+			lines[i] = w.line(jsKey(k)+": ", t.values[k], indent+"  ")
+		}
+		return "{\n" + strings.Join(lines, "") + indent + "}", ""
+	case []any:
+		if simple(t) {
+			items := make([]string, len(t))
+			for i, e := range t {
+				items[i], _ = w.render(e, indent)
+			}
+			return "[" + strings.Join(items, ", ") + "]", ""
+		}
+		lines := make([]string, len(t))
+		for i, e := range t {
+			lines[i] = w.line("", e, indent+"  ")
+		}
+		return "[\n" + strings.Join(lines, "") + indent + "]", ""
+	}
+
+	return jsString(fmt.Sprint(v)), ""
+}
+
+// line renders an object property or list item on its own line
+func (w *writer) line(prefix string, v any, indent string) string {
+	code, comment := w.render(v, indent)
+	line := indent + prefix + code + ","
+	if len(comment) > 0 {
+		line += " // " + comment
+	}
+	return line + "\n"
+}
+
+// simple reports whether a list fits on one line
+func simple(list []any) bool {
+	for _, e := range list {
+		switch e.(type) {
+		case *object, []any, todo:
+			return false
+		}
+	}
+	return true
+}
+
+func jsKey(k string) string {
+	if identRe.MatchString(k) {
+		return k
+	}
+	return jsString(k)
+}
+
+// jsString quotes s, multi-line strings become template literals
+func jsString(s string) string {
+	if strings.Contains(s, "\n") {
+		return "`" + escapeTemplate(s) + "`"
+	}
+
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	s = strings.ReplaceAll(s, "\r", `\r`)
+	s = strings.ReplaceAll(s, "\t", `\t`)
+	return "'" + s + "'"
+}
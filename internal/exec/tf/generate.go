@@ -0,0 +1,136 @@
+package tf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/moonwalker/comet/internal/log"
+	"github.com/moonwalker/comet/internal/modules"
+	"github.com/moonwalker/comet/internal/schema"
+)
+
+const (
+	errGenerateExists = "generate %s: %s already exists and was not generated by comet, remove it or set if_exists to skip"
+)
+
+type manifest struct {
+	Files []string `json:"files"` // relative to the component directory
+}
+
+// writeGenerated writes the generated files of the component, files comet
+// generated before are always replaced, other files are never written or
+// listed in the manifest, so clean and removed entries can't delete them,
+// generated files that are no longer declared are removed
+func writeGenerated(component *schema.Component) error {
+	prev, err := readManifest(component.Path)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(component.Generate))
+	for name := range component.Generate {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := []string{}
+	for _, name := range names {
+		g := component.Generate[name]
+		target, err := g.Target(name, component.Path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(component.Path, target)
+
+		if _, err := os.Stat(target); err == nil && !slices.Contains(prev.Files, rel) {
+			if g.IfExists != schema.IfExistsSkip {
+				return fmt.Errorf(errGenerateExists, name, rel)
+			}
+			log.Debug("generate skipped, file exists", "name", name, "path", rel)
+			continue
+		}
+
+		err = os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(target, []byte(g.Contents), 0644)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+	}
+
+	for _, f := range prev.Files {
+		if !slices.Contains(files, f) {
+			err = os.Remove(filepath.Join(component.Path, f))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	if len(files) == 0 {
+		err = os.Remove(filepath.Join(component.Path, modules.GeneratedManifest))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	return writeJSON(&manifest{Files: files}, component.Path, modules.GeneratedManifest)
+}
+
+// GeneratedFiles returns the files listed in the manifest of dir, relative
+// to dir
+func GeneratedFiles(dir string) ([]string, error) {
+	m, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	return m.Files, nil
+}
+
+// RemoveGenerated removes the files listed in the manifest of dir and the
+// manifest itself
+func RemoveGenerated(dir string) error {
+	m, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range m.Files {
+		path := filepath.Join(dir, f)
+		log.Info("removing", "file", path)
+		err = os.Remove(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return os.Remove(filepath.Join(dir, modules.GeneratedManifest))
+}
+
+func readManifest(dir string) (*manifest, error) {
+	m := &manifest{}
+
+	b, err := os.ReadFile(filepath.Join(dir, modules.GeneratedManifest))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", modules.GeneratedManifest, err)
+	}
+
+	return m, nil
+}
@@ -1,8 +1,8 @@
 package tf
 
 import (
+	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -10,6 +10,7 @@ import (
 	"path"
 	"strings"
 
+	"github.com/hashicorp/go-version"
 	"github.com/hashicorp/terraform-exec/tfexec"
 
 	"github.com/moonwalker/comet/internal/log"
@@ -17,12 +18,14 @@ import (
 )
 
 var (
-	errCmdNotFound = "command not found: %s"
-	errEmptyState  = "empty state for: %s"
-	backendFile    = "backend.tf.json"
-	providersFile  = "providers_gen.tf"
-	varsFileFmt    = "%s-%s.tfvars.json"
-	planFileFmt    = "%s-%s.planfile"
+	errCmdNotFound      = "command not found: %s"
+	errEmptyState       = "empty state for: %s"
+	backendFile         = "backend.tf.json"
+	providersFile       = "providers_gen.tf.json"
+	providersAppendFile = "providers_gen.tf" // append('providers', …) lines, HCL
+	versionsFile        = "versions_gen_override.tf.json"
+	varsFileFmt         = "%s-%s.tfvars.json"
+	planFileFmt         = "%s-%s.planfile"
 )
 
 type executor struct {
@@ -139,6 +142,51 @@ func (e *executor) Apply(component *schema.Component) error {
 	return tf.Apply(context.Background(), tfexec.VarFile(varsfile))
 }
 
+func (e *executor) Changes(component *schema.Component) ([]*schema.ResourceChange, error) {
+	log.Debug("changes", "component", component.Name)
+
+	tf, err := tfexec.NewTerraform(component.Path, e.config.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	planfile := fmt.Sprintf(planFileFmt, component.Stack, component.Name)
+	plan, err := tf.ShowPlanFile(context.Background(), planfile)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]*schema.ResourceChange, 0, len(plan.ResourceChanges))
+	for _, rc := range plan.ResourceChanges {
+		if rc.Change == nil {
+			continue
+		}
+		actions := make([]string, 0, len(rc.Change.Actions))
+		for _, a := range rc.Change.Actions {
+			actions = append(actions, string(a))
+		}
+		changes = append(changes, &schema.ResourceChange{Address: rc.Address, Actions: actions})
+	}
+
+	return changes, nil
+}
+
+func (e *executor) ApplyPlan(component *schema.Component) error {
+	log.Debug("apply plan", "component", component.Name)
+
+	tf, err := tfexec.NewTerraform(component.Path, e.config.Command)
+	if err != nil {
+		return err
+	}
+
+	tf.SetSkipProviderVerify(true)
+	tf.SetStdout(os.Stdout)
+	tf.SetStderr(os.Stderr)
+
+	planfile := fmt.Sprintf(planFileFmt, component.Stack, component.Name)
+	return tf.Apply(context.Background(), tfexec.DirOrPlan(planfile))
+}
+
 func (e *executor) Destroy(component *schema.Component) error {
 	log.Debug("destroy", "component", component.Name)
 
@@ -193,6 +241,23 @@ func (e *executor) Output(component *schema.Component) (map[string]*schema.Outpu
 	return output, nil
 }
 
+func (e *executor) Version() (*version.Version, error) {
+	log.Debug("version", "command", e.config.Command)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	tf, err := tfexec.NewTerraform(wd, e.config.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	v, _, err := tf.Version(context.Background(), false)
+	return v, err
+}
+
 // utils
 
 func prepareProvision(component *schema.Component, generateBackend bool) (string, error) {
@@ -209,7 +274,17 @@ func prepareProvision(component *schema.Component, generateBackend bool) (string
 		}
 	}
 
-	err = writeProvidersTF(component)
+	err = writeProvidersJSON(component)
+	if err != nil {
+		return "", err
+	}
+
+	err = writeVersionsJSON(component)
+	if err != nil {
+		return "", err
+	}
+
+	err = writeGenerated(component)
 	if err != nil {
 		return "", err
 	}
@@ -234,224 +309,112 @@ func writeBackendJSON(component *schema.Component) error {
 	return nil
 }
 
-func writeProviderConfig(i int, pc map[string]interface{}) string {
-	sb := strings.Builder{}
-
-	for k, v := range pc {
-		if k == "alias" && i > 2 {
-			continue
-		}
-		if m, ok := v.(map[string]interface{}); ok {
-			sb.WriteString(strings.Repeat(" ", i))
-			sb.WriteString(fmt.Sprintf("%s {", k))
-			sb.WriteString("\n")
-			pc := writeProviderConfig(i+2, m)
-			sb.WriteString(pc)
-			sb.WriteString(strings.Repeat(" ", i))
-			sb.WriteString("}\n")
-			continue
-		}
-		sb.WriteString(strings.Repeat(" ", i))
-		vs := fmt.Sprintf("%s", v)
-		if strings.HasPrefix(vs, "data.") ||
-			strings.HasPrefix(vs, "module.") ||
-			strings.HasPrefix(vs, "local.") ||
-			strings.HasPrefix(vs, "var.") {
-			sb.WriteString(fmt.Sprintf("%s = %s", k, v))
-		} else {
-			_, err := base64.StdEncoding.DecodeString(vs)
-			if err == nil {
-				sb.WriteString(fmt.Sprintf(`%s = base64decode("%s")`, k, v))
-			} else {
-				sb.WriteString(fmt.Sprintf(`%s = "%s"`, k, v))
-			}
+// writeVersionsJSON writes the required tofu version and providers of the
+// component as an override file, so tofu merges the providers into the
+// required_providers of the module per provider instead of rejecting a
+// second block, the file is removed when the component has none
+func writeVersionsJSON(component *schema.Component) error {
+	v := component.Versions
+	if v == nil || len(v.Tofu) == 0 && len(v.Providers) == 0 {
+		err := os.Remove(path.Join(component.Path, versionsFile))
+		if err != nil && !os.IsNotExist(err) {
+			return err
 		}
-		sb.WriteString("\n")
-	}
-
-	return sb.String()
-}
-
-func writeProvidersTF(component *schema.Component) error {
-	if len(component.Providers) == 0 {
 		return nil
 	}
 
-	sb := strings.Builder{}
-
-	// Use captured provider dependencies from component
-	if len(component.ProviderDependencies) > 0 {
-		// Generate enhanced provider configuration with remote state fallbacks
-		generateRemoteStateDataSources(&sb, component.ProviderDependencies, component)
-		generateLocalFallbacks(&sb, component.ProviderDependencies)
-		generateVariableOverrides(&sb, component.ProviderDependencies)
-
-		// Generate providers with enhanced configurations using locals
-		for k, v := range component.Providers {
-			sb.WriteString(fmt.Sprintf(`provider "%s" {`, k))
-			if m, ok := v.(map[string]interface{}); ok {
-				pc := writeProviderConfigWithLocals(2, m, component.ProviderDependencies)
-				if len(pc) > 0 {
-					sb.WriteString("\n")
-					sb.WriteString(pc)
-				}
-			}
-			sb.WriteString("}\n\n")
-		}
-	} else {
-		// Use standard provider generation
-		for k, v := range component.Providers {
-			sb.WriteString(fmt.Sprintf(`provider "%s" {`, k))
-			if m, ok := v.(map[string]interface{}); ok {
-				pc := writeProviderConfig(2, m)
-				if len(pc) > 0 {
-					sb.WriteString("\n")
-					sb.WriteString(pc)
-				}
-			}
-			sb.WriteString("}\n\n")
-		}
+	tf := map[string]interface{}{}
+	if len(v.Tofu) > 0 {
+		tf["required_version"] = v.Tofu
 	}
-
-	for _, line := range component.Appends["providers"] {
-		sb.WriteString(line)
-		sb.WriteString("\n")
+	if len(v.Providers) > 0 {
+		tf["required_providers"] = v.Providers
 	}
 
-	s := strings.TrimSpace(sb.String()) + "\n"
-	return os.WriteFile(path.Join(component.Path, providersFile), []byte(s), 0644)
+	return writeJSON(map[string]interface{}{"terraform": tf}, component.Path, versionsFile)
 }
 
-// Generate remote state data sources
-func generateRemoteStateDataSources(sb *strings.Builder, deps map[string]string, component *schema.Component) {
-	sb.WriteString("# Auto-generated remote state data sources for component dependencies\n")
-	for comp := range deps {
-		sb.WriteString(fmt.Sprintf(`data "terraform_remote_state" "%s" {
-  backend = "%s"
-  config = {`, comp, component.Backend.Type))
-
-		sb.WriteString("\n")
-		for k, v := range component.Backend.Config {
-			configValue := fmt.Sprintf("%v", v)
-			// Replace current component name with dependency component name in the path
-			if strings.Contains(configValue, component.Name) {
-				configValue = strings.ReplaceAll(configValue, component.Name, comp)
-			}
-			sb.WriteString(fmt.Sprintf(`    %s = "%s"`, k, configValue))
-			sb.WriteString("\n")
+// writeProvidersJSON writes the providers of the component, and the remote
+// state data sources they read, in the JSON syntax so values keep their types
+func writeProvidersJSON(component *schema.Component) error {
+	appendsPath := path.Join(component.Path, providersAppendFile)
+	lines := component.Appends["providers"]
+	if len(lines) > 0 {
+		err := os.WriteFile(appendsPath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+		if err != nil {
+			return err
 		}
-		sb.WriteString("  }\n}\n\n")
+	} else if err := os.Remove(appendsPath); err != nil && !os.IsNotExist(err) {
+		return err
 	}
-}
 
-// Generate local variables with try() fallbacks
-func generateLocalFallbacks(sb *strings.Builder, deps map[string]string) {
-	sb.WriteString("# Locals with safe fallbacks for component dependencies\n")
-	sb.WriteString("locals {\n")
-	for comp := range deps {
-		sb.WriteString(fmt.Sprintf(`  %s_kube_host = try(
-    data.terraform_remote_state.%s.outputs.kube_host,
-    var.%s_kube_host,
-    "https://127.0.0.1"
-  )
-  %s_kube_cert = try(
-    data.terraform_remote_state.%s.outputs.kube_cert,
-    var.%s_kube_cert,
-    ""
-  )
-`, comp, comp, comp, comp, comp, comp))
-	}
-	sb.WriteString("}\n\n")
-}
-
-// Generate variable overrides for manual configuration
-func generateVariableOverrides(sb *strings.Builder, deps map[string]string) {
-	for comp := range deps {
-		sb.WriteString(fmt.Sprintf(`# Variables for manual override of %s outputs (optional)
-variable "%s_kube_host" {
-  description = "Kubernetes cluster host from %s component (auto-detected from remote state)"
-  type        = string
-  default     = null
-}
-
-variable "%s_kube_cert" {
-  description = "Kubernetes cluster CA certificate from %s component (auto-detected from remote state)"
-  type        = string
-  default     = null
-}
-
-`, comp, comp, comp, comp, comp))
+	jsonPath := path.Join(component.Path, providersFile)
+	if len(component.Providers) == 0 {
+		err := os.Remove(jsonPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
 	}
-}
 
-// Enhanced provider config writer that replaces <no value> with local references
-func writeProviderConfigWithLocals(i int, pc map[string]interface{}, deps map[string]string) string {
-	sb := strings.Builder{}
+	providers := make(map[string]interface{}, len(component.Providers))
+	for k, v := range component.Providers {
+		providers[k] = providerValue(v)
+	}
+	doc := map[string]interface{}{"provider": providers}
 
-	for k, v := range pc {
-		if k == "alias" && i > 2 {
-			continue
-		}
-		if m, ok := v.(map[string]interface{}); ok {
-			sb.WriteString(strings.Repeat(" ", i))
-			sb.WriteString(fmt.Sprintf("%s {", k))
-			sb.WriteString("\n")
-			pc := writeProviderConfigWithLocals(i+2, m, deps)
-			sb.WriteString(pc)
-			sb.WriteString(strings.Repeat(" ", i))
-			sb.WriteString("}\n")
-			continue
-		}
-		sb.WriteString(strings.Repeat(" ", i))
-		vs := fmt.Sprintf("%s", v)
-
-		// Replace <no value> with appropriate local references
-		if vs == "<no value>" {
-			if replacement := getLocalReferenceForProperty(k, deps); replacement != "" {
-				sb.WriteString(fmt.Sprintf("%s = %s", k, replacement))
-			} else {
-				// Fallback to null for unknown properties
-				sb.WriteString(fmt.Sprintf("%s = null", k))
-			}
-		} else if strings.HasPrefix(vs, "data.") ||
-			strings.HasPrefix(vs, "module.") ||
-			strings.HasPrefix(vs, "local.") ||
-			strings.HasPrefix(vs, "var.") {
-			sb.WriteString(fmt.Sprintf("%s = %s", k, v))
-		} else {
-			_, err := base64.StdEncoding.DecodeString(vs)
-			if err == nil {
-				sb.WriteString(fmt.Sprintf(`%s = base64decode("%s")`, k, v))
-			} else {
-				sb.WriteString(fmt.Sprintf(`%s = "%s"`, k, v))
+	// outputs that didn't resolve are read from the state of their component
+	if len(component.RemoteStates) > 0 {
+		remoteStates := make(map[string]interface{}, len(component.RemoteStates))
+		for name, rs := range component.RemoteStates {
+			remoteStates[name] = map[string]interface{}{
+				"backend": rs.Backend.Type,
+				"config":  rs.Backend.Config,
 			}
 		}
-		sb.WriteString("\n")
+		doc["data"] = map[string]interface{}{"terraform_remote_state": remoteStates}
 	}
 
-	return sb.String()
+	return writeJSON(doc, component.Path, providersFile)
 }
 
-// Get appropriate local reference for common Kubernetes provider properties
-func getLocalReferenceForProperty(propertyName string, deps map[string]string) string {
-	// For now, assume the dependency is 'gke' (most common case)
-	// In a more complete implementation, this would be smarter about detecting which dependency provides which properties
-	for component := range deps {
-		switch propertyName {
-		case "host":
-			return fmt.Sprintf("local.%s_kube_host", component)
-		case "cluster_ca_certificate":
-			return fmt.Sprintf("local.%s_kube_cert", component)
+// providerValue converts a provider config to the JSON syntax, where strings
+// are templates: only { expr: 'var.x' } becomes an expression, maps are blocks
+// or objects, and lists of maps are repeated blocks or several aliased
+// instances of a provider
+func providerValue(v any) any {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if expr, ok := t["expr"].(string); ok && len(t) == 1 {
+			return "${" + expr + "}"
+		}
+		res := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			res[k] = providerValue(e)
 		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(t))
+		for i, e := range t {
+			res[i] = providerValue(e)
+		}
+		return res
 	}
-	return ""
+	return v
 }
 
+// writeJSON writes v indented, without escaping <, > and & which are common
+// in version constraints and expressions
 func writeJSON(v any, dir string, filename string) error {
-	b, err := json.MarshalIndent(v, "", "  ")
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	err := enc.Encode(v)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(path.Join(dir, filename), b, 0644)
+	return os.WriteFile(path.Join(dir, filename), b.Bytes(), 0644)
 }
@@ -0,0 +1,275 @@
+package tf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moonwalker/comet/internal/modules"
+	"github.com/moonwalker/comet/internal/schema"
+)
+
+func TestWriteProvidersJSON(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, providersAppendFile), []byte("# stale\n"), 0644)
+
+	component := &schema.Component{
+		Path: dir,
+		Providers: map[string]interface{}{
+			"google": []interface{}{
+				map[string]interface{}{"project": "acme", "region": "us-central1"},
+				map[string]interface{}{"alias": "eu", "project": "acme", "region": "europe-west1"},
+			},
+			"kubernetes": map[string]interface{}{
+				"host":                   "${data.terraform_remote_state.dev_gke.outputs.endpoint}",
+				"cluster_ca_certificate": "c2VjcmV0",
+				"token":                  map[string]interface{}{"expr": "var.token"},
+				"config_path":            map[string]interface{}{"expr": "local.kubeconfig"},
+				"proxy_url":              "data.example.com",
+				"insecure":               false,
+				"retries":                float64(3),
+				"ignore_labels":          []interface{}{"a", "b"},
+				"exec": []interface{}{
+					map[string]interface{}{"command": "gke-gcloud-auth-plugin"},
+				},
+			},
+		},
+		RemoteStates: map[string]*schema.RemoteState{
+			"dev_gke": {Stack: "dev", Component: "gke", Backend: schema.Backend{Type: "gcs", Config: map[string]interface{}{"bucket": "tf", "prefix": "dev/gke"}}},
+		},
+	}
+
+	err := writeProvidersJSON(component)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(dir, providersFile))
+	want := `{
+  "data": {
+    "terraform_remote_state": {
+      "dev_gke": {
+        "backend": "gcs",
+        "config": {
+          "bucket": "tf",
+          "prefix": "dev/gke"
+        }
+      }
+    }
+  },
+  "provider": {
+    "google": [
+      {
+        "project": "acme",
+        "region": "us-central1"
+      },
+      {
+        "alias": "eu",
+        "project": "acme",
+        "region": "europe-west1"
+      }
+    ],
+    "kubernetes": {
+      "cluster_ca_certificate": "c2VjcmV0",
+      "config_path": "${local.kubeconfig}",
+      "exec": [
+        {
+          "command": "gke-gcloud-auth-plugin"
+        }
+      ],
+      "host": "${data.terraform_remote_state.dev_gke.outputs.endpoint}",
+      "ignore_labels": [
+        "a",
+        "b"
+      ],
+      "insecure": false,
+      "proxy_url": "data.example.com",
+      "retries": 3,
+      "token": "${var.token}"
+    }
+  }
+}
+`
+	if string(got) != want {
+		t.Errorf("%s =\n%s\nwant\n%s", providersFile, got, want)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, providersAppendFile)); !os.IsNotExist(err) {
+		t.Errorf("stale %s was not removed", providersAppendFile)
+	}
+}
+
+func TestWriteVersionsJSON(t *testing.T) {
+	dir := t.TempDir()
+	// the module declares its own required_providers
+	moduleVersions := "terraform {\n  required_providers {\n    google = { source = \"hashicorp/google\" }\n  }\n}\n"
+	os.WriteFile(filepath.Join(dir, "versions.tf"), []byte(moduleVersions), 0644)
+
+	component := &schema.Component{
+		Path: dir,
+		Versions: &schema.Versions{
+			Tofu:      ">= 1.8",
+			Providers: map[string]*schema.ProviderVersion{"google": {Source: "hashicorp/google", Version: "~> 6.0"}},
+		},
+	}
+
+	err := writeVersionsJSON(component)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(dir, versionsFile))
+	want := `{
+  "terraform": {
+    "required_providers": {
+      "google": {
+        "source": "hashicorp/google",
+        "version": "~> 6.0"
+      }
+    },
+    "required_version": ">= 1.8"
+  }
+}
+`
+	if string(got) != want {
+		t.Errorf("%s =\n%s\nwant\n%s", versionsFile, got, want)
+	}
+
+	// an override file merges into the module's block instead of duplicating it
+	if !strings.HasSuffix(versionsFile, "_override.tf.json") {
+		t.Errorf("%s is not an override file", versionsFile)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "versions.tf")); string(b) != moduleVersions {
+		t.Errorf("versions.tf changed:\n%s", b)
+	}
+
+	component.Versions = nil
+	err = writeVersionsJSON(component)
+	if _, serr := os.Stat(filepath.Join(dir, versionsFile)); err != nil || !os.IsNotExist(serr) {
+		t.Errorf("%s was not removed: %v", versionsFile, err)
+	}
+}
+
+func TestWriteGenerated(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.tf"), []byte("user"), 0644)
+
+	component := &schema.Component{Path: dir, Generate: map[string]*schema.Generate{
+		"main":   {Path: "main.tf", Contents: "generated", IfExists: schema.IfExistsSkip},
+		"locals": {Path: "gen/locals.tf", Contents: "locals {}", IfExists: schema.IfExistsOverwrite},
+	}}
+
+	err := writeGenerated(component)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := os.ReadFile(filepath.Join(dir, "main.tf")); string(b) != "user" {
+		t.Errorf("main.tf = %s, want the file kept", b)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "gen", "locals.tf")); string(b) != "locals {}" {
+		t.Errorf("gen/locals.tf = %s", b)
+	}
+
+	component.Generate["main"].IfExists = schema.IfExistsError
+	err = writeGenerated(component)
+	if err == nil || !strings.Contains(err.Error(), "main.tf already exists") {
+		t.Errorf("if_exists error = %v", err)
+	}
+
+	// files comet generated are replaced, and removed once no longer declared
+	component.Generate = map[string]*schema.Generate{
+		"locals": {Path: "gen/locals.tf", Contents: "locals { a = 1 }", IfExists: schema.IfExistsError},
+	}
+	err = writeGenerated(component)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "gen", "locals.tf")); string(b) != "locals { a = 1 }" {
+		t.Errorf("gen/locals.tf = %s", b)
+	}
+
+	component.Generate = nil
+	err = writeGenerated(component)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"gen/locals.tf", modules.GeneratedManifest} {
+		if _, err := os.Stat(filepath.Join(dir, f)); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", f)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "main.tf")); err != nil {
+		t.Error("main.tf removed")
+	}
+}
+
+func TestWriteGeneratedKeepsModuleFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "provider.tf"), []byte("user"), 0644)
+
+	// overwrite only replaces files comet generated
+	component := &schema.Component{Path: dir, Generate: map[string]*schema.Generate{
+		"provider": {Path: "provider.tf", Contents: "generated", IfExists: schema.IfExistsOverwrite},
+	}}
+	err := writeGenerated(component)
+	if err == nil || !strings.Contains(err.Error(), "provider.tf already exists") {
+		t.Errorf("if_exists overwrite error = %v", err)
+	}
+
+	component.Generate["provider"].IfExists = schema.IfExistsSkip
+	component.Generate["locals"] = &schema.Generate{Path: "locals.tf", Contents: "locals {}", IfExists: schema.IfExistsError}
+	err = writeGenerated(component)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _ := GeneratedFiles(dir)
+	if len(files) != 1 || files[0] != "locals.tf" {
+		t.Errorf("manifest = %v, want only locals.tf", files)
+	}
+
+	// removing the entry, then cleaning, keeps the module file
+	delete(component.Generate, "provider")
+	err = writeGenerated(component)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = RemoveGenerated(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "provider.tf")); string(b) != "user" {
+		t.Errorf("provider.tf = %q, want the module file kept", b)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "locals.tf")); !os.IsNotExist(err) {
+		t.Error("generated locals.tf not removed")
+	}
+}
+
+func TestRemoveGenerated(t *testing.T) {
+	dir := t.TempDir()
+	component := &schema.Component{Path: dir, Generate: map[string]*schema.Generate{
+		"backend": {Path: "backend.tf", Contents: "terraform {}", IfExists: schema.IfExistsOverwrite},
+	}}
+
+	err := writeGenerated(component)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := GeneratedFiles(dir)
+	if err != nil || len(files) != 1 || files[0] != "backend.tf" {
+		t.Errorf("GeneratedFiles() = %v, %v", files, err)
+	}
+
+	err = RemoveGenerated(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"backend.tf", modules.GeneratedManifest} {
+		if _, err := os.Stat(filepath.Join(dir, f)); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", f)
+		}
+	}
+}
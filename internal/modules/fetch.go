@@ -0,0 +1,195 @@
+package modules
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/moonwalker/comet/internal/log"
+)
+
+var (
+	// checked out modules, one directory per commit
+	CacheDir = filepath.Join(".comet", "modules")
+	// working copies of remote components when no work_dir is configured
+	WorkDir = filepath.Join(".comet", "work")
+
+	commitRe = regexp.MustCompile(`^[0-9a-f]{40}$`)
+)
+
+type Fetcher struct {
+	CacheDir string
+	Lock     *Lock
+}
+
+// Fetch resolves a remote component source to a local directory, using the
+// lockfile in the current directory and recording newly resolved refs in it
+func Fetch(path string) (string, error) {
+	lock, err := LoadLock(LockFile)
+	if err != nil {
+		return "", err
+	}
+
+	f := &Fetcher{CacheDir: CacheDir, Lock: lock}
+
+	src, err := ParseSource(path)
+	if err != nil {
+		return "", err
+	}
+
+	_, locked := lock.get(src.key())
+
+	dir, err := f.Fetch(src)
+	if err != nil {
+		return "", err
+	}
+
+	if !locked {
+		err = lock.Save(LockFile)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return dir, nil
+}
+
+// Fetch checks out the locked commit of a source into the cache and returns
+// the module directory within it
+func (f *Fetcher) Fetch(src *Source) (string, error) {
+	commit, ok := f.Lock.get(src.key())
+	if !ok {
+		var err error
+		commit, err = resolve(src)
+		if err != nil {
+			return "", err
+		}
+		f.Lock.set(src.key(), commit)
+		log.Debug("module ref resolved", "source", src.key(), "commit", commit)
+	}
+
+	dir := filepath.Join(f.CacheDir, commit)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		err = f.checkout(src, commit, dir)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	moduleDir := filepath.Join(dir, filepath.FromSlash(src.Subdir))
+	info, err := os.Stat(moduleDir)
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("module source %s: directory %s not found at %s", src, src.Subdir, commit[:8])
+	}
+
+	return moduleDir, nil
+}
+
+// resolve finds the commit a ref currently points to
+func resolve(src *Source) (string, error) {
+	ref := src.Ref
+	if len(ref) == 0 {
+		ref = "HEAD"
+	}
+
+	out, err := git("", "ls-remote", src.URL, ref, ref+"^{}")
+	if err != nil {
+		return "", fmt.Errorf("module source %s: %w", src, err)
+	}
+
+	refs := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			refs[fields[1]] = fields[0]
+		}
+	}
+
+	// peeled annotated tags point to the commit rather than the tag object
+	for _, name := range []string{ref, "refs/heads/" + ref, "refs/tags/" + ref + "^{}", "refs/tags/" + ref} {
+		if commit, ok := refs[name]; ok {
+			return commit, nil
+		}
+	}
+
+	if commitRe.MatchString(ref) {
+		return ref, nil
+	}
+
+	return "", fmt.Errorf("module source %s: ref %s not found", src, ref)
+}
+
+// checkout fetches a single commit into a temporary directory and moves it
+// into place once complete, so interrupted fetches never leave a partial
+// module in the cache
+func (f *Fetcher) checkout(src *Source, commit, dir string) error {
+	log.Debug("fetching module", "source", src.String(), "commit", commit)
+
+	err := os.MkdirAll(f.CacheDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp(f.CacheDir, "fetch-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	_, err = git(tmp, "init", "-q")
+	if err != nil {
+		return err
+	}
+
+	// servers that don't allow fetching a commit directly need the full history
+	_, err = git(tmp, "fetch", "-q", "--depth", "1", src.URL, commit)
+	if err != nil {
+		_, err = git(tmp, "fetch", "-q", "--tags", src.URL, "+refs/heads/*:refs/remotes/origin/*")
+		if err != nil {
+			return fmt.Errorf("module source %s: %w", src, err)
+		}
+	}
+
+	_, err = git(tmp, "checkout", "-q", commit)
+	if err != nil {
+		return fmt.Errorf("module source %s: %w", src, err)
+	}
+
+	err = os.RemoveAll(filepath.Join(tmp, ".git"))
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp, dir)
+	if err != nil && !exists(dir) {
+		return err
+	}
+
+	return nil
+}
+
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,123 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/moonwalker/comet/internal/log"
+)
+
+const (
+	LockFile = "comet.lock.json"
+)
+
+// Lock pins every module source to the commit it resolved to the first time
+// it was fetched, so all environments keep using the same code until the
+// entry is removed
+type Lock struct {
+	Version int                   `json:"version"`
+	Modules map[string]*LockEntry `json:"modules"`
+
+	mu sync.Mutex
+}
+
+type LockEntry struct {
+	Commit string `json:"commit"`
+}
+
+// LoadLock reads the lockfile, returning an empty lock if it doesn't exist
+func LoadLock(path string) (*Lock, error) {
+	lock := &Lock{Version: 1, Modules: map[string]*LockEntry{}}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+
+	err = json.Unmarshal(data, lock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse lock file %s: %w", path, err)
+	}
+	if lock.Modules == nil {
+		lock.Modules = map[string]*LockEntry{}
+	}
+
+	return lock, nil
+}
+
+// Save writes the lockfile with stable ordering, so it can be committed
+func (l *Lock) Save(path string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal lock file: %w", err)
+	}
+
+	err = os.WriteFile(path, append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+
+	return nil
+}
+
+// PruneLock drops the lockfile entries of refs that none of the given
+// component paths use any more, the paths must cover every stack since an
+// entry of a stack that isn't loaded would be lost
+func PruneLock(paths []string) error {
+	lock, err := LoadLock(LockFile)
+	if err != nil || len(lock.Modules) == 0 {
+		return err
+	}
+
+	used := map[string]bool{}
+	for _, p := range paths {
+		if !IsRemote(p) {
+			continue
+		}
+		src, err := ParseSource(p)
+		if err != nil {
+			return err
+		}
+		used[src.key()] = true
+	}
+
+	pruned := false
+	for key := range lock.Modules {
+		if !used[key] {
+			log.Debug("module ref no longer used", "source", key)
+			delete(lock.Modules, key)
+			pruned = true
+		}
+	}
+	if !pruned {
+		return nil
+	}
+
+	return lock.Save(LockFile)
+}
+
+func (l *Lock) get(key string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.Modules[key]
+	if !ok {
+		return "", false
+	}
+	return e.Commit, true
+}
+
+func (l *Lock) set(key, commit string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.Modules[key] = &LockEntry{Commit: commit}
+}
@@ -0,0 +1,236 @@
+package modules
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Source
+	}{
+		{"git::file:///tmp/modules.git//vpc?ref=v1.4.0", Source{URL: "file:///tmp/modules.git", Subdir: "vpc", Ref: "v1.4.0"}},
+		{"git::https://github.com/org/modules.git", Source{URL: "https://github.com/org/modules.git"}},
+		{"https://github.com/org/modules.git//net/vpc/", Source{URL: "https://github.com/org/modules.git", Subdir: "net/vpc"}},
+		{"git@github.com:org/modules.git//vpc?ref=main", Source{URL: "git@github.com:org/modules.git", Subdir: "vpc", Ref: "main"}},
+		{"git::ssh://git@github.com/org/modules.git?ref=abc", Source{URL: "ssh://git@github.com/org/modules.git", Ref: "abc"}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSource(tt.in)
+		if err != nil {
+			t.Errorf("ParseSource(%s) error = %v", tt.in, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("ParseSource(%s) = %+v, want %+v", tt.in, *got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"git::file:///tmp/m.git//../x", "git::file:///tmp/m.git?depth=1", "git::"} {
+		if _, err := ParseSource(in); err == nil {
+			t.Errorf("ParseSource(%s) error = nil", in)
+		}
+	}
+
+	if IsRemote("modules/vpc") || !IsRemote("git::file:///tmp/m.git") {
+		t.Error("IsRemote() misclassified source")
+	}
+}
+
+// newRepo creates a bare repository with a vpc module tagged v1 and v2
+func newRepo(t *testing.T) (string, map[string]string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	work := filepath.Join(dir, "work")
+	bare := filepath.Join(dir, "modules.git")
+
+	run := func(dir string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	os.MkdirAll(filepath.Join(work, "vpc"), 0755)
+	run(work, "init", "-q", "-b", "main")
+
+	commits := map[string]string{}
+	for _, v := range []string{"v1", "v2"} {
+		os.WriteFile(filepath.Join(work, "vpc", "main.tf"), []byte("# "+v+"\n"), 0644)
+		run(work, "add", "-A")
+		run(work, "commit", "-q", "-m", v)
+		run(work, "tag", "-a", v, "-m", v)
+		commits[v] = run(work, "rev-parse", "HEAD")
+	}
+
+	run(dir, "clone", "-q", "--bare", work, bare)
+
+	return "file://" + filepath.ToSlash(bare), commits
+}
+
+func TestFetch(t *testing.T) {
+	repo, commits := newRepo(t)
+	cache := filepath.Join(t.TempDir(), "modules")
+
+	f := &Fetcher{CacheDir: cache, Lock: &Lock{Version: 1, Modules: map[string]*LockEntry{}}}
+
+	src, _ := ParseSource("git::" + repo + "//vpc?ref=v1")
+	dir, err := f.Fetch(src)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	if want := filepath.Join(cache, commits["v1"], "vpc"); dir != want {
+		t.Errorf("Fetch() = %s, want %s", dir, want)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "main.tf")); string(b) != "# v1\n" {
+		t.Errorf("main.tf = %q, want v1", b)
+	}
+	if exists(filepath.Join(cache, commits["v1"], ".git")) {
+		t.Error("checkout contains .git")
+	}
+	if c, _ := f.Lock.get(src.key()); c != commits["v1"] {
+		t.Errorf("lock = %s, want %s", c, commits["v1"])
+	}
+
+	// the lock wins over where the ref points now
+	head, _ := ParseSource("git::" + repo + "//vpc")
+	f.Lock.set(head.key(), commits["v1"])
+	dir, err = f.Fetch(head)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "main.tf")); string(b) != "# v1\n" {
+		t.Errorf("locked main.tf = %q, want v1", b)
+	}
+
+	// an unlocked ref resolves to its current commit
+	v2, _ := ParseSource("git::" + repo + "//vpc?ref=v2")
+	dir, err = f.Fetch(v2)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "main.tf")); string(b) != "# v2\n" {
+		t.Errorf("main.tf = %q, want v2", b)
+	}
+
+	missing, _ := ParseSource("git::" + repo + "//nope?ref=v1")
+	if _, err := f.Fetch(missing); err == nil {
+		t.Error("Fetch() missing subdir error = nil")
+	}
+
+	badref, _ := ParseSource("git::" + repo + "?ref=v9")
+	if _, err := f.Fetch(badref); err == nil {
+		t.Error("Fetch() missing ref error = nil")
+	}
+}
+
+func TestLockRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), LockFile)
+
+	lock, err := LoadLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.set("git::b", "2")
+	lock.set("git::a", "1")
+
+	err = lock.Save(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err = LoadLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := lock.get("git::a"); !ok || c != "1" {
+		t.Errorf("get(git::a) = %s, %v", c, ok)
+	}
+
+	b, _ := os.ReadFile(path)
+	if strings.Index(string(b), "git::a") > strings.Index(string(b), "git::b") {
+		t.Errorf("lock file not sorted:\n%s", b)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	dir := t.TempDir()
+	v1, v2, dest := filepath.Join(dir, "v1"), filepath.Join(dir, "v2"), filepath.Join(dir, "work")
+
+	os.MkdirAll(v1, 0755)
+	os.WriteFile(filepath.Join(v1, "main.tf"), []byte("# v1\n"), 0644)
+	os.WriteFile(filepath.Join(v1, "old.tf"), []byte("# v1\n"), 0644)
+	os.MkdirAll(v2, 0755)
+	os.WriteFile(filepath.Join(v2, "main.tf"), []byte("# v2\n"), 0644)
+
+	if err := Copy(v1, dest); err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+
+	// state and generated files written after the copy
+	os.MkdirAll(filepath.Join(dest, ".terraform"), 0755)
+	os.WriteFile(filepath.Join(dest, "terraform.tfstate"), []byte("{}"), 0644)
+	os.WriteFile(filepath.Join(dest, "backend.tf.json"), []byte("{}"), 0644)
+	os.WriteFile(filepath.Join(dest, "dev-vpc.tfvars.json"), []byte("{}"), 0644)
+
+	// the same checkout again keeps everything
+	if err := Copy(v1, dest); err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+	if !exists(filepath.Join(dest, "old.tf")) {
+		t.Error("old.tf removed without a module change")
+	}
+
+	if err := Copy(v2, dest); err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+	if exists(filepath.Join(dest, "old.tf")) {
+		t.Error("old.tf of the previous checkout is still in the work dir")
+	}
+	if b, _ := os.ReadFile(filepath.Join(dest, "main.tf")); string(b) != "# v2\n" {
+		t.Errorf("main.tf = %q, want v2", b)
+	}
+	for _, name := range []string{".terraform", "terraform.tfstate", "backend.tf.json", "dev-vpc.tfvars.json"} {
+		if !exists(filepath.Join(dest, name)) {
+			t.Errorf("%s removed from the work dir", name)
+		}
+	}
+}
+
+func TestPruneLock(t *testing.T) {
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	lock := &Lock{Version: 1, Modules: map[string]*LockEntry{}}
+	lock.set("https://example.com/modules.git?ref=v1", "1")
+	lock.set("https://example.com/modules.git?ref=v2", "2")
+	lock.Save(LockFile)
+
+	err := PruneLock([]string{"modules/local", "git::https://example.com/modules.git//vpc?ref=v2"})
+	if err != nil {
+		t.Fatalf("PruneLock() error = %v", err)
+	}
+
+	lock, _ = LoadLock(LockFile)
+	if _, ok := lock.get("https://example.com/modules.git?ref=v1"); ok {
+		t.Error("unused ref v1 is still locked")
+	}
+	if c, ok := lock.get("https://example.com/modules.git?ref=v2"); !ok || c != "2" {
+		t.Errorf("used ref v2 = %s, %v", c, ok)
+	}
+}
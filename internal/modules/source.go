@@ -0,0 +1,89 @@
+package modules
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	gitPrefix = "git::"
+)
+
+// Source is a component source in a git repository, e.g.
+// git::https://github.com/org/modules.git//vpc?ref=v1.4.0
+type Source struct {
+	URL    string // repository URL passed to git
+	Subdir string // directory within the repository, empty for the root
+	Ref    string // branch, tag or commit, empty for the default branch
+}
+
+// IsRemote reports whether a component path refers to a git source instead
+// of a local directory
+func IsRemote(path string) bool {
+	return strings.HasPrefix(path, gitPrefix) ||
+		strings.HasPrefix(path, "git@") ||
+		strings.Contains(path, "://")
+}
+
+// ParseSource parses a git source in the go-getter style used by Terraform:
+// an optional git:: prefix, the repository URL, an optional //subdir and an
+// optional ?ref= query
+func ParseSource(s string) (*Source, error) {
+	raw := strings.TrimPrefix(s, gitPrefix)
+
+	query := ""
+	if i := strings.Index(raw, "?"); i >= 0 {
+		raw, query = raw[:i], raw[i+1:]
+	}
+
+	// the subdir separator is the first // after the scheme
+	start := 0
+	if i := strings.Index(raw, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	src := &Source{URL: raw}
+	if i := strings.Index(raw[start:], "//"); i >= 0 {
+		src.URL = raw[:start+i]
+		src.Subdir = strings.Trim(raw[start+i+2:], "/")
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid module source %s: %w", s, err)
+	}
+	for k := range values {
+		if k != "ref" {
+			return nil, fmt.Errorf("invalid module source %s: unsupported parameter %s", s, k)
+		}
+	}
+	src.Ref = values.Get("ref")
+
+	if len(src.URL) == 0 {
+		return nil, fmt.Errorf("invalid module source %s: missing repository", s)
+	}
+	if strings.Contains(src.Subdir, "..") {
+		return nil, fmt.Errorf("invalid module source %s: subdir must stay within the repository", s)
+	}
+
+	return src, nil
+}
+
+// key identifies the repository and ref in the lockfile
+func (s *Source) key() string {
+	if len(s.Ref) == 0 {
+		return s.URL
+	}
+	return s.URL + "?ref=" + s.Ref
+}
+
+func (s *Source) String() string {
+	str := gitPrefix + s.URL
+	if len(s.Subdir) > 0 {
+		str += "//" + s.Subdir
+	}
+	if len(s.Ref) > 0 {
+		str += "?ref=" + s.Ref
+	}
+	return str
+}
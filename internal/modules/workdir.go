@@ -0,0 +1,82 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	cp "github.com/otiai10/copy"
+
+	"github.com/moonwalker/comet/internal/log"
+)
+
+const (
+	// GeneratedManifest lists the files generate() wrote into a component
+	// directory, so they can be replaced and cleaned up later
+	GeneratedManifest = ".comet-generated.json"
+
+	// workSourceFile records the module directory last copied into a work dir
+	workSourceFile = ".comet-source"
+)
+
+// files in a work dir that don't come from the module: tofu's working
+// directory and state, and the files comet generates before init
+var workFiles = []string{
+	".terraform", ".terraform.lock.hcl", "terraform.tfstate", "terraform.tfstate.backup", "terraform.tfstate.d",
+	"backend.tf.json", "providers_gen.tf.json", "providers_gen.tf", "versions_gen_override.tf.json", "*.tfvars.json",
+	GeneratedManifest, workSourceFile,
+}
+
+// Copy copies a fetched module into its work dir, when the work dir holds
+// another checkout its module files are removed first, so files deleted or
+// renamed upstream don't stay behind
+func Copy(src, dest string) error {
+	prev, err := os.ReadFile(filepath.Join(dest, workSourceFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if len(prev) > 0 && strings.TrimSpace(string(prev)) != src {
+		log.Debug("module changed, cleaning work dir", "dir", dest, "from", strings.TrimSpace(string(prev)), "to", src)
+		err = clearWorkDir(dest)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = cp.Copy(src, dest)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dest, workSourceFile), []byte(src+"\n"), 0644)
+}
+
+// clearWorkDir removes everything but the work files from dir
+func clearWorkDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if isWorkFile(e.Name()) {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isWorkFile(name string) bool {
+	for _, pattern := range workFiles {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
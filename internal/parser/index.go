@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/moonwalker/comet/internal/log"
+	"github.com/moonwalker/comet/internal/schema"
+)
+
+var (
+	indexFile     = filepath.Join(".comet", "stacks.json")
+	errStaleIndex = errors.New("stack index is stale")
+)
+
+type (
+	// index maps stack names to the files declaring them, so a single
+	// stack can be loaded without parsing every file in the stacks dir
+	index struct {
+		Dir    string                 `json:"dir"`
+		Stacks map[string]*indexEntry `json:"stacks"`
+	}
+
+	indexEntry struct {
+		Path string `json:"path"`
+	}
+)
+
+func loadIndex(dir string) *index {
+	idx := &index{Dir: dir, Stacks: map[string]*indexEntry{}}
+
+	data, err := os.ReadFile(indexFile)
+	if err != nil {
+		return idx
+	}
+
+	stored := &index{}
+	err = json.Unmarshal(data, stored)
+	if err != nil || stored.Dir != dir || stored.Stacks == nil {
+		log.Debug("ignoring stack index", "path", indexFile, "error", err)
+		return idx
+	}
+
+	return stored
+}
+
+// lookup returns the file declaring the stack, if it still exists
+func (idx *index) lookup(name string) string {
+	e, ok := idx.Stacks[name]
+	if !ok {
+		return ""
+	}
+
+	_, err := os.Stat(e.Path)
+	if err != nil {
+		return ""
+	}
+
+	return e.Path
+}
+
+func (idx *index) update(stacks *schema.Stacks) {
+	for _, s := range stacks.OrderByName() {
+		idx.Stacks[s.Name] = &indexEntry{Path: s.Path}
+	}
+}
+
+func (idx *index) save() {
+	err := os.MkdirAll(filepath.Dir(indexFile), 0755)
+	if err == nil {
+		var data []byte
+		data, err = json.MarshalIndent(idx, "", "  ")
+		if err == nil {
+			err = os.WriteFile(indexFile, data, 0644)
+		}
+	}
+	if err != nil {
+		log.Debug("stack index write failed", "path", indexFile, "error", err)
+	}
+}
@@ -0,0 +1,162 @@
+package js
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/moonwalker/comet/internal/log"
+)
+
+const (
+	// bump when the bundle format changes to invalidate existing caches
+	bundleVersion = 2
+)
+
+var (
+	cacheDir = filepath.Join(".comet", "cache")
+)
+
+// Bundle is a cached esbuild output for a single stack file, together with
+// what was learned about it the last time it was executed
+type Bundle struct {
+	Version int               `json:"version"`
+	Key     string            `json:"key"`
+	Entry   string            `json:"entry"`
+	Inputs  map[string]string `json:"inputs"` // file path -> sha256 of its contents
+	Code    string            `json:"code"`
+	Stack   string            `json:"stack,omitempty"` // stack name declared by the file
+	Refs    []string          `json:"refs,omitempty"`  // stacks referenced through state
+}
+
+// Lookup returns the cached bundle for a stack file if none of its inputs
+// changed since it was written
+func Lookup(path string) (*Bundle, bool) {
+	b, err := readBundle(path)
+	if err != nil || b.Version != bundleVersion {
+		return nil, false
+	}
+
+	key, err := inputsKey(b.Inputs)
+	if err != nil || key != b.Key {
+		return nil, false
+	}
+
+	return b, true
+}
+
+func newBundle(path string, code []byte, metafile string) (*Bundle, error) {
+	var meta struct {
+		Inputs map[string]any `json:"inputs"`
+	}
+	err := json.Unmarshal([]byte(metafile), &meta)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(meta.Inputs)+1)
+	files = append(files, path)
+	for p := range meta.Inputs {
+		files = append(files, p)
+	}
+
+	b := &Bundle{Version: bundleVersion, Entry: path, Code: string(code), Inputs: map[string]string{}}
+	err = b.track(files...)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// track adds files to the bundle inputs, so the bundle is invalidated
+// whenever one of them changes
+func (b *Bundle) track(files ...string) error {
+	for _, f := range files {
+		sum, err := fileHash(f)
+		if err != nil {
+			return err
+		}
+		b.Inputs[filepath.Clean(f)] = sum
+	}
+
+	key, err := inputsKey(b.Inputs)
+	if err != nil {
+		return err
+	}
+	b.Key = key
+
+	return nil
+}
+
+func (b *Bundle) save() {
+	err := os.MkdirAll(cacheDir, 0755)
+	if err == nil {
+		var data []byte
+		data, err = json.Marshal(b)
+		if err == nil {
+			err = os.WriteFile(cachePath(b.Entry), data, 0644)
+		}
+	}
+	if err != nil {
+		log.Debug("bundle cache write failed", "path", b.Entry, "error", err)
+	}
+}
+
+func readBundle(path string) (*Bundle, error) {
+	data, err := os.ReadFile(cachePath(path))
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{}
+	err = json.Unmarshal(data, b)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// inputsKey hashes the contents of all inputs into a single cache key
+func inputsKey(inputs map[string]string) (string, error) {
+	files := make([]string, 0, len(inputs))
+	for f := range inputs {
+		files = append(files, f)
+	}
+	slices.Sort(files)
+
+	h := sha256.New()
+	for _, f := range files {
+		sum, err := fileHash(f)
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(f + "\x00" + sum + "\n"))
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fileHash(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func cachePath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	sum := sha256.Sum256([]byte(abs))
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return filepath.Join(cacheDir, name+"-"+hex.EncodeToString(sum[:8])+".json")
+}
@@ -0,0 +1,167 @@
+package js
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+const (
+	frameContext = 2 // lines of source shown around the failing line
+)
+
+// ScriptError is a stack file failure pointing at the original source
+type ScriptError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+	Frame   string // code frame around the failing line
+	Stack   string // JS stack trace
+}
+
+func (e *ScriptError) Error() string {
+	sb := strings.Builder{}
+
+	if len(e.File) > 0 {
+		sb.WriteString(fmt.Sprintf("%s:%d:%d: ", e.File, e.Line, e.Column))
+	}
+	sb.WriteString(e.Message)
+
+	if len(e.Frame) > 0 {
+		sb.WriteString("\n\n")
+		sb.WriteString(e.Frame)
+	}
+	if len(e.Stack) > 0 {
+		sb.WriteString("\n")
+		sb.WriteString(e.Stack)
+	}
+
+	return sb.String()
+}
+
+// buildError formats esbuild errors with their location and code frame
+func buildError(path string, msgs []api.Message) error {
+	errs := make([]error, 0, len(msgs))
+
+	for _, m := range msgs {
+		e := &ScriptError{Message: m.Text}
+		if loc := m.Location; loc != nil {
+			e.File, e.Line, e.Column = loc.File, loc.Line, loc.Column+1
+			e.Frame = codeFrame(loc.File, loc.Line, loc.Column+1)
+		}
+		errs = append(errs, e)
+	}
+
+	return fmt.Errorf(errBuild, path, errors.Join(errs...))
+}
+
+// scriptError maps a goja exception to the original source through the
+// inline source map of the bundle
+func scriptError(err error) error {
+	var ex *goja.Exception
+	if !errors.As(err, &ex) {
+		return err
+	}
+
+	e := &ScriptError{Message: ex.Value().String()}
+	if goerr := ex.Unwrap(); goerr != nil {
+		e.Message = goerr.Error()
+	}
+
+	// the outermost frame is the bundle's wrapper invocation
+	frames := ex.Stack()
+	if len(frames) > 1 {
+		frames = frames[:len(frames)-1]
+	}
+
+	sb := strings.Builder{}
+	for _, f := range frames {
+		pos := f.Position()
+		if len(pos.Filename) == 0 {
+			continue
+		}
+
+		if len(e.File) == 0 {
+			e.File, e.Line, e.Column = pos.Filename, pos.Line, pos.Column
+		}
+
+		if f.FuncName() == "<anonymous>" {
+			sb.WriteString(fmt.Sprintf("    at %s:%d:%d\n", pos.Filename, pos.Line, pos.Column))
+		} else {
+			sb.WriteString(fmt.Sprintf("    at %s (%s:%d:%d)\n", f.FuncName(), pos.Filename, pos.Line, pos.Column))
+		}
+	}
+
+	e.Stack = sb.String()
+	if len(e.File) > 0 {
+		e.Frame = codeFrame(e.File, e.Line, e.Column)
+	}
+
+	return e
+}
+
+// codeFrame renders the lines around line with a marker under column
+func codeFrame(path string, line, column int) string {
+	b, err := os.ReadFile(path)
+	if err != nil || line < 1 {
+		return ""
+	}
+
+	lines := strings.Split(string(b), "\n")
+	if line > len(lines) {
+		return ""
+	}
+
+	first := max(line-frameContext, 1)
+	last := min(line+frameContext, len(lines))
+	width := len(fmt.Sprint(last))
+
+	sb := strings.Builder{}
+	for n := first; n <= last; n++ {
+		marker := " "
+		if n == line {
+			marker = ">"
+		}
+		sb.WriteString(fmt.Sprintf("%s %*d | %s\n", marker, width, n, lines[n-1]))
+		if n == line && column > 0 {
+			sb.WriteString(fmt.Sprintf("  %s | %s^\n", strings.Repeat(" ", width), strings.Repeat(" ", column-1)))
+		}
+	}
+
+	return sb.String()
+}
+
+// set registers a Go function in the runtime, turning panics into JS
+// errors so they carry the position of the calling stack file line
+func (vm *jsinterpreter) set(name string, v any) {
+	fv := reflect.ValueOf(v)
+	if fv.Kind() != reflect.Func {
+		vm.rt.Set(name, v)
+		return
+	}
+
+	wrapped := reflect.MakeFunc(fv.Type(), func(args []reflect.Value) []reflect.Value {
+		defer func() {
+			if r := recover(); r != nil {
+				switch r.(type) {
+				case goja.Value, *goja.Exception:
+					panic(r)
+				}
+				panic(vm.rt.NewGoError(fmt.Errorf("%s(): %v", name, r)))
+			}
+		}()
+
+		if fv.Type().IsVariadic() {
+			return fv.CallSlice(args)
+		}
+		return fv.Call(args)
+	})
+
+	vm.rt.Set(name, wrapped.Interface())
+}
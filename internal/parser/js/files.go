@@ -0,0 +1,214 @@
+package js
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/moonwalker/comet/internal/log"
+	"github.com/moonwalker/comet/internal/schema"
+)
+
+const (
+	errOutsideRoot = "path %s is outside of the repository root %s"
+	errTemplateVar = "templatefile %s: no value for %s"
+)
+
+var (
+	tmplVarRe = regexp.MustCompile(`\$\{\s*([A-Za-z_][\w.]*)\s*\}`)
+)
+
+// resolvePath resolves path relative to the stack file being parsed and
+// refuses anything outside the repository root (the working directory),
+// symlinks are followed so a link inside the root can't point outside
+func (vm *jsinterpreter) resolvePath(path string) (string, error) {
+	root, err := realPath(".")
+	if err != nil {
+		return "", err
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(vm.path), path)
+	}
+
+	abs, err := realPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf(errOutsideRoot, path, root)
+	}
+
+	return rel, nil
+}
+
+// realPath returns the absolute path with symlinks resolved, paths that
+// don't exist are kept so reading them reports the missing file
+func realPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	real, err := filepath.EvalSymlinks(abs)
+	if errors.Is(err, os.ErrNotExist) {
+		return abs, nil
+	}
+
+	return real, err
+}
+
+// readFile reads a file for the stack and records it, so the bundle cache
+// is invalidated when the file changes
+func (vm *jsinterpreter) readFile(path string) ([]byte, error) {
+	p, err := vm.resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug("read file", "path", p, "stack", vm.path)
+
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	vm.reads = append(vm.reads, p)
+	return b, nil
+}
+
+// fileFunc returns the contents of a file as a string
+func (vm *jsinterpreter) fileFunc(path string) (string, error) {
+	b, err := vm.readFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// templatefileFunc renders a file, replacing ${name} placeholders with vars,
+// {{ }} expressions are left alone and resolved later like any other input
+func (vm *jsinterpreter) templatefileFunc(path string, vars map[string]interface{}) (string, error) {
+	b, err := vm.readFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var missing string
+	res := tmplVarRe.ReplaceAllStringFunc(string(b), func(m string) string {
+		key := tmplVarRe.FindStringSubmatch(m)[1]
+		v, ok := lookupVar(vars, key)
+		if !ok {
+			if len(missing) == 0 {
+				missing = key
+			}
+			return m
+		}
+		if s, ok := v.(string); ok {
+			return s
+		}
+		jb, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(jb)
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf(errTemplateVar, path, missing)
+	}
+
+	return res, nil
+}
+
+// yamlFunc parses a YAML file into a JS value
+func (vm *jsinterpreter) yamlFunc(path string) (any, error) {
+	b, err := vm.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	jb, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, fmt.Errorf("yaml %s: %w", path, err)
+	}
+
+	var v any
+	err = json.Unmarshal(jb, &v)
+	if err != nil {
+		return nil, fmt.Errorf("yaml %s: %w", path, err)
+	}
+
+	return v, nil
+}
+
+// jsonFunc parses a JSON file into a JS value
+func (vm *jsinterpreter) jsonFunc(path string) (any, error) {
+	b, err := vm.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var v any
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return nil, fmt.Errorf("json %s: %w", path, err)
+	}
+
+	return v, nil
+}
+
+// varsFunc loads YAML or JSON files and deep-merges them, in order, into
+// the stack options exposed to templates. The merged values are returned.
+func (vm *jsinterpreter) varsFunc(stack *schema.Stack) func(...string) (any, error) {
+	return func(paths ...string) (any, error) {
+		vars := map[string]interface{}{}
+		for _, path := range paths {
+			b, err := vm.readFile(path)
+			if err != nil {
+				return nil, err
+			}
+
+			v, err := schema.ParseVars(b)
+			if err != nil {
+				return nil, fmt.Errorf("vars %s: %w", path, err)
+			}
+			vars = schema.MergeVars(vars, v)
+		}
+
+		vm.vars = schema.MergeVars(vm.vars, vars)
+		stack.Options = vm.stackOptions()
+
+		return vars, nil
+	}
+}
+
+// stackOptions merges the stack() options over the vars() files, the same
+// whether vars() is called before or after stack()
+func (vm *jsinterpreter) stackOptions() map[string]interface{} {
+	return schema.MergeVars(schema.MergeVars(nil, vm.vars), vm.options)
+}
+
+// lookupVar resolves a dotted key like "db.host" in vars
+func lookupVar(vars map[string]interface{}, key string) (any, bool) {
+	var cur any = vars
+	for _, part := range strings.Split(key, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		cur, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
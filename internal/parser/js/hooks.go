@@ -0,0 +1,94 @@
+package js
+
+import (
+	"fmt"
+
+	"github.com/dop251/goja"
+
+	"github.com/moonwalker/comet/internal/schema"
+)
+
+const (
+	errHookEvent = "unknown hook event: %s"
+	errHookValue = "hook %s must be a command, a function or { run, optional }"
+)
+
+// hooks converts a hooks object from the stack file, each event takes a
+// shell command, a callback, { run, optional } or a list of those
+func (vm *jsinterpreter) hooks(v goja.Value) (schema.Hooks, error) {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil, nil
+	}
+
+	obj := v.ToObject(vm.rt)
+	hooks := schema.Hooks{}
+
+	for _, event := range obj.Keys() {
+		if !schema.ValidHookEvent(event) {
+			return nil, fmt.Errorf(errHookEvent, event)
+		}
+
+		val := obj.Get(event)
+		items := []goja.Value{val}
+		if o, ok := val.(*goja.Object); ok && o.ClassName() == "Array" {
+			items = items[:0]
+			for _, k := range o.Keys() {
+				items = append(items, o.Get(k))
+			}
+		}
+
+		for _, item := range items {
+			h, err := vm.hook(event, item, true)
+			if err != nil {
+				return nil, err
+			}
+			hooks[event] = append(hooks[event], h)
+		}
+	}
+
+	return hooks, nil
+}
+
+func (vm *jsinterpreter) hook(event string, v goja.Value, nested bool) (*schema.Hook, error) {
+	if fn, ok := goja.AssertFunction(v); ok {
+		return &schema.Hook{Func: vm.hookFunc(fn)}, nil
+	}
+
+	if s, ok := v.Export().(string); ok && len(s) > 0 {
+		return &schema.Hook{Command: s}, nil
+	}
+
+	obj, ok := v.(*goja.Object)
+	if !ok || !nested || obj.ClassName() != "Object" {
+		return nil, fmt.Errorf(errHookValue, event)
+	}
+
+	h, err := vm.hook(event, obj.Get("run"), false)
+	if err != nil {
+		return nil, err
+	}
+	if optional := obj.Get("optional"); optional != nil {
+		h.Optional = optional.ToBoolean()
+	}
+
+	return h, nil
+}
+
+// hookFunc calls a stack file callback with the hook context
+func (vm *jsinterpreter) hookFunc(fn goja.Callable) schema.HookFunc {
+	return func(ctx *schema.HookContext) error {
+		_, err := fn(goja.Undefined(), vm.rt.ToValue(map[string]any{
+			"event":     ctx.Event,
+			"operation": ctx.Operation,
+			"stack":     ctx.Stack,
+			"component": ctx.Component,
+			"path":      ctx.Path,
+			"outputs":   ctx.Outputs,
+			"error":     ctx.Error,
+		}))
+		if err != nil {
+			return scriptError(err)
+		}
+		return nil
+	}
+}
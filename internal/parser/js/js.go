@@ -1,8 +1,10 @@
 package js
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"time"
@@ -16,12 +18,20 @@ import (
 )
 
 const (
-	errBuild   = "error building %s: %v"
-	errOutputs = "no output files for %s"
+	errBuild      = "error building %s: %w"
+	errOutputs    = "no output files for %s"
+	errLabels     = "labels must be an object"
+	errLabelValue = "label %s must be a string, number or boolean"
+	errMockOps    = "mock_outputs_allowed must be a list of operations"
 )
 
 type jsinterpreter struct {
 	rt                     *goja.Runtime
+	path                   string                 // stack file being parsed
+	reads                  []string               // files read by the stack through file helpers
+	vars                   map[string]interface{} // merged vars() files, stack() options override them
+	options                map[string]interface{} // stack() options
+	refs                   map[*goja.Object]*ref
 	secretsDefaultProvider string
 	secretsDefaultPath     string
 }
@@ -29,6 +39,7 @@ type jsinterpreter struct {
 func NewInterpreter() (*jsinterpreter, error) {
 	vm := &jsinterpreter{
 		rt:                     goja.New(),
+		refs:                   map[*goja.Object]*ref{},
 		secretsDefaultProvider: "sops",
 		secretsDefaultPath:     "secrets.enc.yaml",
 	}
@@ -39,53 +50,92 @@ func NewInterpreter() (*jsinterpreter, error) {
 func (vm *jsinterpreter) Parse(path string) (*schema.Stack, error) {
 	log.Debug("JS Parse started", "path", path)
 
-	buildStart := time.Now()
-	result := api.Build(api.BuildOptions{
-		EntryPoints: []string{path},
-		Bundle:      true,
-		Write:       false,
-	})
-	buildTime := time.Since(buildStart)
-	log.Debug("esbuild completed", "path", path, "duration", buildTime)
+	vm.path = path
 
-	if len(result.Errors) > 0 {
-		return nil, fmt.Errorf(errBuild, path, result.Errors)
-	}
-	if len(result.OutputFiles) == 0 {
-		return nil, fmt.Errorf(errOutputs, path)
+	bundle, err := vm.bundle(path)
+	if err != nil {
+		return nil, err
 	}
 
 	stack := schema.NewStack(path, "js")
 
 	setupStart := time.Now()
-	vm.rt.Set("print", fmt.Println)
-	vm.rt.Set("env", vm.envProxy())
-	vm.rt.Set("envs", vm.envsFuncForStack(stack))
-	vm.rt.Set("secrets", vm.secretsFunc)
-	vm.rt.Set("secretsConfig", vm.secretsConfigFunc)
-	vm.rt.Set("secret", vm.secretFunc)
-	vm.rt.Set("stack", vm.registerStack(stack))
-	vm.rt.Set("metadata", vm.registerMetadata(stack))
-	vm.rt.Set("backend", vm.registerBackend(stack))
-	vm.rt.Set("component", vm.registerComponent(stack))
-	vm.rt.Set("append", vm.registerAppend(stack))
-	vm.rt.Set("kubeconfig", vm.registerKubeconfig(stack))
+	vm.set("print", fmt.Println)
+	vm.set("env", vm.envProxy())
+	vm.set("envs", vm.envsFuncForStack(stack))
+	vm.set("secrets", vm.secretsFunc)
+	vm.set("secretsConfig", vm.secretsConfigFunc)
+	vm.set("secret", vm.secretFunc)
+	vm.set("file", vm.fileFunc)
+	vm.set("templatefile", vm.templatefileFunc)
+	vm.set("yaml", vm.yamlFunc)
+	vm.set("json", vm.jsonFunc)
+	vm.set("vars", vm.varsFunc(stack))
+	vm.set("stack", vm.registerStack(stack))
+	vm.set("metadata", vm.registerMetadata(stack))
+	vm.set("backend", vm.registerBackend(stack))
+	vm.set("component", vm.registerComponent(stack))
+	vm.set("append", vm.registerAppend(stack))
+	vm.set("kubeconfig", vm.registerKubeconfig(stack))
+	vm.set("versions", vm.registerVersions(stack))
+	vm.set("generate", vm.registerGenerate(stack))
 	setupTime := time.Since(setupStart)
 	log.Debug("Runtime setup completed", "path", path, "duration", setupTime)
 
 	execStart := time.Now()
-	src := result.OutputFiles[0].Contents
-	_, err := vm.rt.RunString(string(src))
+	_, err = vm.rt.RunScript(path, bundle.Code)
 	execTime := time.Since(execStart)
 	log.Debug("Script execution completed", "path", path, "duration", execTime)
 
 	if err != nil {
-		return nil, err
+		return nil, scriptError(err)
+	}
+
+	// remember what the file declares, so unchanged files can be skipped
+	bundle.Stack = stack.Name
+	bundle.Refs = stack.References()
+	err = bundle.track(vm.reads...)
+	if err != nil {
+		log.Debug("tracking files read failed", "path", path, "error", err)
+	} else {
+		bundle.save()
 	}
 
 	return stack, nil
 }
 
+// bundle returns the esbuild output for path, reusing the cached one
+// when neither the entry file nor its imports changed
+func (vm *jsinterpreter) bundle(path string) (*Bundle, error) {
+	if b, ok := Lookup(path); ok {
+		log.Debug("esbuild cache hit", "path", path)
+		return b, nil
+	}
+
+	buildStart := time.Now()
+	result := api.Build(api.BuildOptions{
+		EntryPoints: []string{path},
+		Bundle:      true,
+		Write:       false,
+		Metafile:    true,
+		// inline source maps let goja report original file positions,
+		// sources are relative to the stack file like the script name
+		Sourcemap: api.SourceMapInline,
+		Outdir:    filepath.Dir(path),
+	})
+	buildTime := time.Since(buildStart)
+	log.Debug("esbuild completed", "path", path, "duration", buildTime)
+
+	if len(result.Errors) > 0 {
+		return nil, buildError(path, result.Errors)
+	}
+	if len(result.OutputFiles) == 0 {
+		return nil, fmt.Errorf(errOutputs, path)
+	}
+
+	return newBundle(path, result.OutputFiles[0].Contents, result.Metafile)
+}
+
 func (vm *jsinterpreter) envProxy() any {
 	return vm.getProxy(func(key string) any {
 		return os.Getenv(key)
@@ -212,7 +262,7 @@ func (vm *jsinterpreter) envsFunc(args ...goja.Value) any {
 	return nil
 }
 
-func (vm *jsinterpreter) secretsFunc(ref string) any {
+func (vm *jsinterpreter) secretsFunc(ref string) (any, error) {
 	start := time.Now()
 	log.Debug("secrets.Get called", "ref", ref)
 
@@ -221,10 +271,10 @@ func (vm *jsinterpreter) secretsFunc(ref string) any {
 	log.Debug("secrets.Get completed", "ref", ref, "duration", duration)
 
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	return res
+	return res, nil
 }
 
 // secretsConfigFunc allows configuring default secrets provider and path
@@ -238,15 +288,15 @@ func (vm *jsinterpreter) secretsConfigFunc(config map[string]interface{}) {
 }
 
 // secretFunc is a shorthand version of secretsFunc using configured defaults
-func (vm *jsinterpreter) secretFunc(path string) any {
+func (vm *jsinterpreter) secretFunc(path string) (any, error) {
 	start := time.Now()
 	log.Debug("secret called", "path", path)
 
 	// If path already has a provider prefix, use it as-is
-	if strings.HasPrefix(path, "sops://") || strings.HasPrefix(path, "op://") {
-		result := vm.secretsFunc(path)
+	if secrets.IsRef(path) {
+		result, err := vm.secretsFunc(path)
 		log.Debug("secret completed", "path", path, "duration", time.Since(start))
-		return result
+		return result, err
 	}
 
 	// Support dot notation (e.g., "datadog.api_key" -> "datadog/api_key")
@@ -254,17 +304,29 @@ func (vm *jsinterpreter) secretFunc(path string) any {
 
 	// Construct full reference using defaults
 	ref := fmt.Sprintf("%s://%s#/%s", vm.secretsDefaultProvider, vm.secretsDefaultPath, path)
-	result := vm.secretsFunc(ref)
+	result, err := vm.secretsFunc(ref)
 	log.Debug("secret completed", "path", path, "duration", time.Since(start))
-	return result
+	return result, err
 }
 
-func (vm *jsinterpreter) registerStack(stack *schema.Stack) func(string, map[string]interface{}) goja.Value {
-	return func(name string, options map[string]interface{}) goja.Value {
-		log.Debug("register stack", "name", name, "options", options)
+func (vm *jsinterpreter) registerStack(stack *schema.Stack) func(string, goja.Value) (goja.Value, error) {
+	return func(name string, options goja.Value) (goja.Value, error) {
+		log.Debug("register stack", "name", name)
 		stack.Name = name
-		stack.Options = options
-		return vm.rt.ToValue(stack)
+
+		hooks, err := vm.hooks(vm.get(options, "hooks"))
+		if err != nil {
+			return nil, err
+		}
+		stack.Hooks = hooks
+
+		opts := vm.exportMap(options)
+		delete(opts, "hooks")
+
+		vm.options = opts
+		stack.Options = vm.stackOptions()
+
+		return vm.rt.ToValue(stack), nil
 	}
 }
 
@@ -308,6 +370,11 @@ func (vm *jsinterpreter) registerMetadata(stack *schema.Stack) func(goja.Value)
 			}
 		}
 
+		// Extract protected flag
+		if protectedVal := metaObj.Get("protected"); protectedVal != nil && !goja.IsUndefined(protectedVal) {
+			metadata.Protected = protectedVal.ToBoolean()
+		}
+
 		// Extract custom fields preserving order
 		if customVal := metaObj.Get("custom"); customVal != nil && !goja.IsUndefined(customVal) {
 			if customObj := customVal.ToObject(vm.rt); customObj != nil {
@@ -325,48 +392,179 @@ func (vm *jsinterpreter) registerMetadata(stack *schema.Stack) func(goja.Value)
 	}
 }
 
-func (vm *jsinterpreter) registerBackend(stack *schema.Stack) func(string, map[string]interface{}) {
-	return func(t string, config map[string]interface{}) {
+func (vm *jsinterpreter) registerBackend(stack *schema.Stack) func(string, goja.Value) {
+	return func(t string, config goja.Value) {
 		log.Debug("register backend", "type", t)
-		stack.Backend = schema.Backend{Type: t, Config: config}
+		stack.Backend = schema.Backend{Type: t, Config: vm.exportMap(config)}
 	}
 }
 
-func (vm *jsinterpreter) registerComponent(stack *schema.Stack) func(string, string, map[string]interface{}) any {
-	return func(name string, source string, config map[string]interface{}) any {
+func (vm *jsinterpreter) registerComponent(stack *schema.Stack) func(string, string, goja.Value) (goja.Value, error) {
+	return func(name string, source string, configValue goja.Value) (goja.Value, error) {
 		log.Debug("register component", "name", name, "stack", stack.Name)
 
-		inputs := make(map[string]interface{}, 0)
-		providers := make(map[string]interface{}, 0)
+		config := vm.exportMap(configValue)
+		if config == nil {
+			config = make(map[string]interface{})
+		}
 
 		providers, hasproviders := config["providers"].(map[string]interface{})
 		if hasproviders {
 			delete(config, "providers")
 		}
 
+		// comet options need the inputs form, in flat configs every other key
+		// is a module input, modules commonly take enabled or labels variables
 		inputs, hasinputs := config["inputs"].(map[string]interface{})
 		if !hasinputs {
 			inputs = config
 		}
 
 		c := stack.AddComponent(name, source, inputs, providers)
+		if hasinputs {
+			err := vm.componentOptions(stack, c, configValue, config)
+			if err != nil {
+				return nil, err
+			}
+		}
+		outputs := &ref{expr: c.StateExpr()}
 
-		getfn := func(property string) any {
+		getfn := func(property string) goja.Value {
 			log.Debug("component get proxy", "name", name, "property", property)
 
 			v := c.Inputs[property]
 			if v == nil {
-				// property reference template
-				v = c.PropertyRef(property)
+				// reference to the component output, resolved later
+				return vm.newRef(outputs.attr(property))
 			}
 
-			return v
+			return vm.rt.ToValue(v)
 		}
 
-		return vm.getProxy(getfn)
+		return vm.rt.ToValue(vm.rt.NewProxy(vm.rt.NewObject(), &goja.ProxyTrapConfig{
+			Get: func(target *goja.Object, property string, receiver goja.Value) goja.Value {
+				return getfn(property)
+			},
+		})), nil
 	}
 }
 
+// componentOptions sets the comet keys next to inputs on the component
+func (vm *jsinterpreter) componentOptions(stack *schema.Stack, c *schema.Component, configValue goja.Value, config map[string]interface{}) error {
+	hooks, err := vm.hooks(vm.get(configValue, "hooks"))
+	if err != nil {
+		return err
+	}
+
+	enabled, err := vm.enabled(stack, vm.get(configValue, "enabled"))
+	if err != nil {
+		return err
+	}
+
+	labels, err := labelsMap(config["labels"])
+	if err != nil {
+		return err
+	}
+
+	versions, err := schema.ParseVersions(config["versions"])
+	if err != nil {
+		return err
+	}
+
+	generate, err := schema.ParseGenerates(config["generate"])
+	if err != nil {
+		return err
+	}
+
+	mocksAllowed, err := stringList(config["mock_outputs_allowed"])
+	if err != nil {
+		return err
+	}
+	err = schema.CheckMockOps(mocksAllowed)
+	if err != nil {
+		return err
+	}
+
+	c.Hooks = hooks
+	c.Protect, _ = config["protect"].(bool)
+	c.Disabled = !enabled
+	c.Labels = labels
+	c.MockOutputs, _ = config["mock_outputs"].(map[string]interface{})
+	c.MockOutputsAllowed = mocksAllowed
+	c.Versions = versions
+	c.Generate = generate
+
+	return nil
+}
+
+// enabled evaluates the enabled option of a component, either a boolean or a
+// predicate called with the stack
+func (vm *jsinterpreter) enabled(stack *schema.Stack, v goja.Value) (bool, error) {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return true, nil
+	}
+
+	fn, ok := goja.AssertFunction(v)
+	if !ok {
+		return v.ToBoolean(), nil
+	}
+
+	res, err := fn(goja.Undefined(), vm.rt.ToValue(stack))
+	if err != nil {
+		return false, err
+	}
+
+	return res.ToBoolean(), nil
+}
+
+// labelsMap converts component labels, values must be strings, numbers or
+// booleans since selectors compare them as text
+func labelsMap(v any) (map[string]string, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New(errLabels)
+	}
+
+	labels := make(map[string]string, len(m))
+	for k, lv := range m {
+		switch lv.(type) {
+		case string, bool, int64, float64:
+			labels[k] = fmt.Sprint(lv)
+		default:
+			return nil, fmt.Errorf(errLabelValue, k)
+		}
+	}
+
+	return labels, nil
+}
+
+// stringList converts mock_outputs_allowed, a list of operation names
+func stringList(v any) ([]string, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New(errMockOps)
+	}
+
+	res := make([]string, len(list))
+	for i, e := range list {
+		s, ok := e.(string)
+		if !ok {
+			return nil, errors.New(errMockOps)
+		}
+		res[i] = s
+	}
+
+	return res, nil
+}
+
 func (vm *jsinterpreter) registerAppend(stack *schema.Stack) func(string, []string) {
 	return func(t string, lines []string) {
 		log.Debug("register append", "type", t, "lines", lines, "stack", stack.Name)
@@ -374,6 +572,36 @@ func (vm *jsinterpreter) registerAppend(stack *schema.Stack) func(string, []stri
 	}
 }
 
+// registerVersions sets the versions of all components of the stack, calls
+// are merged so shared files can pin providers
+func (vm *jsinterpreter) registerVersions(stack *schema.Stack) func(goja.Value) error {
+	return func(v goja.Value) error {
+		log.Debug("register versions", "stack", stack.Name)
+		versions, err := schema.ParseVersions(v.Export())
+		if err != nil {
+			return err
+		}
+		stack.Versions = stack.Versions.Merge(versions)
+		return nil
+	}
+}
+
+// registerGenerate adds a file written into every component of the stack
+func (vm *jsinterpreter) registerGenerate(stack *schema.Stack) func(string, goja.Value) error {
+	return func(name string, v goja.Value) error {
+		log.Debug("register generate", "name", name, "stack", stack.Name)
+		g, err := schema.ParseGenerate(name, v.Export())
+		if err != nil {
+			return err
+		}
+		if stack.Generate == nil {
+			stack.Generate = make(map[string]*schema.Generate)
+		}
+		stack.Generate[name] = g
+		return nil
+	}
+}
+
 func (vm *jsinterpreter) registerKubeconfig(stack *schema.Stack) func(*schema.Kubeconfig) {
 	return func(kubeconfig *schema.Kubeconfig) {
 		log.Debug("register kubeconfig", "stack", stack.Name)
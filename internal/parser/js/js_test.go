@@ -0,0 +1,465 @@
+package js
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moonwalker/comet/internal/schema"
+)
+
+func parseSource(t *testing.T, src string) *schema.Stack {
+	t.Helper()
+
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	path := "test.stack.js"
+	err := os.WriteFile(path, []byte(src), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm, err := NewInterpreter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stack, err := vm.Parse(path)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	return stack
+}
+
+func TestOutputReferences(t *testing.T) {
+	stack := parseSource(t, `
+stack('dev', {})
+const vpc = component('vpc', 'modules/vpc', { cidr_block: '10.0.0.0/16' })
+component('app', 'modules/app', {
+  subnet: vpc.subnets[0],
+  prefix: vpc.cidr.split('/')[0],
+  name: `+"`${vpc.id}-app`"+`,
+  link: vpc.network.self_link,
+  dashed: vpc['self-link'],
+  list: [vpc.id],
+  upper: vpc.name.toUpperCase(),
+  input: vpc.cidr_block.split('/')[1],
+})
+kubeconfig({ current: 0, clusters: [{ context: 'c', host: vpc.endpoint, cert: 'x' }] })
+`)
+
+	app, err := stack.GetComponent("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]any{
+		"subnet": `{{ (index (state "dev" "vpc").subnets 0) }}`,
+		"prefix": `{{ (index ((state "dev" "vpc").cidr | split "/") 0) }}`,
+		"name":   `{{ (state "dev" "vpc").id }}-app`,
+		"link":   `{{ (state "dev" "vpc").network.self_link }}`,
+		"dashed": `{{ (index (state "dev" "vpc") "self-link") }}`,
+		"upper":  `{{ ((state "dev" "vpc").name | upper) }}`,
+		"input":  "16",
+	}
+	for k, want := range tests {
+		if got := app.Inputs[k]; got != want {
+			t.Errorf("input %s = %v, want %v", k, got, want)
+		}
+	}
+
+	list, ok := app.Inputs["list"].([]interface{})
+	if !ok || len(list) != 1 || list[0] != `{{ (state "dev" "vpc").id }}` {
+		t.Errorf("input list = %#v", app.Inputs["list"])
+	}
+
+	if len(app.Depends) != 1 || app.Depends[0] != (schema.Dependency{Stack: "dev", Component: "vpc"}) {
+		t.Errorf("Depends = %v, want [dev/vpc]", app.Depends)
+	}
+
+	if host := stack.Kubeconfig.Clusters[0].Host; host != `{{ (state "dev" "vpc").endpoint }}` {
+		t.Errorf("kubeconfig host = %s", host)
+	}
+}
+
+func TestScriptErrorPosition(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	os.MkdirAll("stacks/lib", 0755)
+	os.WriteFile("stacks/lib/helpers.js", []byte("export function broken(x) {\n  // deref\n  return x.foo.bar\n}\n"), 0644)
+	os.WriteFile("stacks/dev.stack.js", []byte("import { broken } from './lib/helpers.js'\n\nstack('dev', {})\nbroken({})\n"), 0644)
+
+	vm, _ := NewInterpreter()
+	_, err := vm.Parse("stacks/dev.stack.js")
+
+	var serr *ScriptError
+	if !errors.As(err, &serr) {
+		t.Fatalf("Parse() error = %v, want ScriptError", err)
+	}
+	if serr.File != "stacks/lib/helpers.js" || serr.Line != 3 {
+		t.Errorf("error position = %s:%d, want stacks/lib/helpers.js:3", serr.File, serr.Line)
+	}
+	if !strings.Contains(serr.Frame, "> 3 |   return x.foo.bar") {
+		t.Errorf("code frame missing failing line:\n%s", serr.Frame)
+	}
+	if !strings.Contains(serr.Stack, "at broken (stacks/lib/helpers.js:3:") || !strings.Contains(serr.Stack, "stacks/dev.stack.js:4:") {
+		t.Errorf("stack trace not mapped:\n%s", serr.Stack)
+	}
+}
+
+func TestSetRecoversPanics(t *testing.T) {
+	vm, _ := NewInterpreter()
+	vm.set("boom", func(s string) string {
+		var m map[string]string
+		m[s] = s
+		return s
+	})
+
+	_, err := vm.rt.RunScript("test.js", "boom('x')")
+	err = scriptError(err)
+
+	var serr *ScriptError
+	if !errors.As(err, &serr) {
+		t.Fatalf("RunScript() error = %v, want ScriptError", err)
+	}
+	if !strings.Contains(serr.Message, "boom(): assignment to entry in nil map") {
+		t.Errorf("message = %s", serr.Message)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	stack := parseSource(t, `
+stack('dev', { region: 'eu', hooks: { before_plan: 'echo stack' } })
+component('gke', 'modules/gke', {
+  inputs: { name: 'gke' },
+  hooks: {
+    after_apply: [
+      'gcloud container clusters get-credentials gke',
+      { run: 'smoke-test', optional: true },
+      (ctx) => { if (ctx.outputs.endpoint !== 'https://gke') throw new Error('bad endpoint ' + ctx.outputs.endpoint) },
+    ],
+  },
+})
+`)
+
+	if _, ok := stack.Options.(map[string]interface{})["hooks"]; ok {
+		t.Error("stack options contain hooks")
+	}
+	if h := stack.Hooks[schema.HookBeforePlan]; len(h) != 1 || h[0].Command != "echo stack" {
+		t.Errorf("stack hooks = %v", stack.Hooks)
+	}
+
+	gke, _ := stack.GetComponent("gke")
+	if _, ok := gke.Inputs["hooks"]; ok {
+		t.Error("component inputs contain hooks")
+	}
+
+	hooks := gke.Hooks[schema.HookAfterApply]
+	if len(hooks) != 3 || hooks[0].Command == "" || !hooks[1].Optional || hooks[2].Func == nil {
+		t.Fatalf("component hooks = %#v", hooks)
+	}
+
+	ctx := &schema.HookContext{Event: schema.HookAfterApply, Outputs: map[string]string{"endpoint": "https://gke"}}
+	if err := hooks[2].Run(ctx); err != nil {
+		t.Errorf("callback error = %v", err)
+	}
+
+	ctx.Outputs["endpoint"] = "x"
+	err := hooks[2].Run(ctx)
+	var serr *ScriptError
+	if !errors.As(err, &serr) || !strings.Contains(serr.Message, "bad endpoint x") || serr.Line != 9 {
+		t.Errorf("callback error = %#v", err)
+	}
+}
+
+func TestHooksInvalid(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	os.WriteFile("test.stack.js", []byte(`stack('dev', {})
+component('a', 'modules/a', { hooks: { after_everything: 'x' }, inputs: {} })
+`), 0644)
+
+	vm, _ := NewInterpreter()
+	_, err := vm.Parse("test.stack.js")
+	if err == nil || !strings.Contains(err.Error(), "unknown hook event: after_everything") {
+		t.Errorf("Parse() error = %v", err)
+	}
+}
+
+func TestProtect(t *testing.T) {
+	stack := parseSource(t, `
+stack('prod', {})
+component('db', 'modules/db', { protect: true, inputs: { tier: 'small' } })
+component('app', 'modules/app', { name: 'app' })
+metadata({ description: 'Production', protected: true })
+`)
+
+	db, _ := stack.GetComponent("db")
+	app, _ := stack.GetComponent("app")
+
+	if !db.Protect || app.Protect {
+		t.Errorf("Protect = %v, %v, want true, false", db.Protect, app.Protect)
+	}
+	if _, ok := db.Inputs["protect"]; ok {
+		t.Error("component inputs contain protect")
+	}
+	if !stack.Metadata.Protected || !stack.Protects(app) {
+		t.Error("stack metadata protection not applied")
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	stack := parseSource(t, `
+stack('dev', { ha: false })
+component('on', 'modules/a', { name: 'on' })
+component('off', 'modules/a', { enabled: false, inputs: { name: 'off' } })
+component('replica', 'modules/a', { enabled: (s) => s.options.ha, inputs: { name: 'replica' } })
+component('named', 'modules/a', { enabled: (s) => s.name === 'dev', inputs: { name: 'named' } })
+component('flat', 'modules/a', { enabled: false, name: 'flat' })
+`)
+
+	tests := map[string]bool{"on": false, "off": true, "replica": true, "named": false, "flat": false}
+	for name, want := range tests {
+		c, _ := stack.GetComponent(name)
+		if c.Disabled != want {
+			t.Errorf("%s Disabled = %v, want %v", name, c.Disabled, want)
+		}
+		if _, ok := c.Inputs["enabled"]; ok && name != "flat" {
+			t.Errorf("%s inputs contain enabled", name)
+		}
+	}
+
+	// in flat configs enabled is a module variable
+	flat, _ := stack.GetComponent("flat")
+	if flat.Inputs["enabled"] != false {
+		t.Errorf("flat config inputs = %v", flat.Inputs)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	stack := parseSource(t, `
+stack('dev', {})
+component('vpc', 'modules/vpc', { labels: { tier: 'network', critical: true, order: 1 }, inputs: { cidr: '10.0.0.0/16' } })
+component('gcs', 'modules/gcs', { labels: { team: ['a', 'b'], cost: { center: 1 } }, name: 'bucket' })
+`)
+
+	vpc, _ := stack.GetComponent("vpc")
+	want := map[string]string{"tier": "network", "critical": "true", "order": "1"}
+	for k, v := range want {
+		if vpc.Labels[k] != v {
+			t.Errorf("label %s = %q, want %q", k, vpc.Labels[k], v)
+		}
+	}
+	if _, ok := vpc.Inputs["labels"]; ok {
+		t.Error("component inputs contain labels")
+	}
+
+	// in flat configs labels is a module variable, of any shape
+	gcs, _ := stack.GetComponent("gcs")
+	inputLabels, _ := gcs.Inputs["labels"].(map[string]interface{})
+	if len(gcs.Labels) > 0 || inputLabels["team"] == nil || inputLabels["cost"] == nil {
+		t.Errorf("flat config labels = %v, inputs = %v", gcs.Labels, gcs.Inputs)
+	}
+}
+
+func TestMockOutputs(t *testing.T) {
+	stack := parseSource(t, `
+stack('dev', {})
+component('vpc', 'modules/vpc', { inputs: { cidr: '10.0.0.0/16' }, mock_outputs: { id: 'vpc-mock', subnet_ids: ['a'] }, mock_outputs_allowed: ['plan', 'validate'] })
+`)
+
+	vpc, _ := stack.GetComponent("vpc")
+	if vpc.MockOutputs["id"] != "vpc-mock" || len(vpc.MockOutputsAllowed) != 2 || vpc.MockOutputsAllowed[0] != "plan" {
+		t.Errorf("mock outputs = %v, allowed = %v", vpc.MockOutputs, vpc.MockOutputsAllowed)
+	}
+	if _, ok := vpc.Inputs["mock_outputs"]; ok {
+		t.Error("component inputs contain mock_outputs")
+	}
+
+	os.WriteFile("bad.stack.js", []byte(`component('vpc', 'modules/vpc', { mock_outputs_allowed: 'plan', inputs: {} })`), 0644)
+	vm, _ := NewInterpreter()
+	_, err := vm.Parse("bad.stack.js")
+	if err == nil || !strings.Contains(err.Error(), errMockOps) {
+		t.Errorf("error = %v, want %s", err, errMockOps)
+	}
+
+	os.WriteFile("bad.stack.js", []byte(`component('vpc', 'modules/vpc', { mock_outputs_allowed: ['apply'], inputs: {} })`), 0644)
+	vm, _ = NewInterpreter()
+	_, err = vm.Parse("bad.stack.js")
+	if err == nil || !strings.Contains(err.Error(), "apply is not one of") {
+		t.Errorf("unknown operation error = %v", err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	stack := parseSource(t, `
+stack('dev', {})
+generate('backend', { path: 'backend.tf', contents: 'terraform {}' })
+component('vpc', 'modules/vpc', { inputs: { cidr: '10.0.0.0/16' }, generate: { locals: { path: 'locals.tf', contents: 'locals {}', if_exists: 'skip' } } })
+`)
+
+	if g := stack.Generate["backend"]; g == nil || g.Path != "backend.tf" || g.IfExists != schema.IfExistsError {
+		t.Errorf("stack generate = %+v", g)
+	}
+
+	vpc, _ := stack.GetComponent("vpc")
+	if g := vpc.Generate["locals"]; g == nil || g.IfExists != schema.IfExistsSkip {
+		t.Errorf("component generate = %+v", g)
+	}
+	if _, ok := vpc.Inputs["generate"]; ok {
+		t.Error("component inputs contain generate")
+	}
+}
+
+func TestVars(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	os.MkdirAll("stacks/vars", 0755)
+	os.WriteFile("stacks/vars/common.yaml", []byte("sizes:\n  gke: { nodes: 3, machine: e2-small }\n"), 0644)
+	os.WriteFile("stacks/vars/prod.yaml", []byte("sizes:\n  gke: { nodes: 6 }\n"), 0644)
+	os.WriteFile("stacks/prod.stack.js", []byte(`
+const v = vars('./vars/common.yaml', './vars/prod.yaml')
+stack('prod', { domain: 'example.io' })
+component('gke', 'modules/gke', { nodes: v.sizes.gke.nodes, machine: '{{ .sizes.gke.machine }}' })
+`), 0644)
+
+	vm, _ := NewInterpreter()
+	stack, err := vm.Parse("stacks/prod.stack.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gke, _ := stack.GetComponent("gke")
+	if gke.Inputs["nodes"] != int64(6) && gke.Inputs["nodes"] != float64(6) {
+		t.Errorf("nodes = %#v, want 6", gke.Inputs["nodes"])
+	}
+
+	opts := stack.Options.(map[string]interface{})
+	if opts["domain"] != "example.io" {
+		t.Errorf("options lost stack() values: %v", opts)
+	}
+	gkeSize := opts["sizes"].(map[string]interface{})["gke"].(map[string]interface{})
+	if gkeSize["machine"] != "e2-small" || gkeSize["nodes"] != float64(6) {
+		t.Errorf("options sizes = %v", gkeSize)
+	}
+}
+
+func TestFileHelpers(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	os.MkdirAll("stacks/files", 0755)
+	os.WriteFile("stacks/files/motd.txt", []byte("hello"), 0644)
+	os.WriteFile("stacks/files/user-data.sh", []byte("echo ${name} ${db.port} {{ .stack }}"), 0644)
+	os.WriteFile("stacks/files/sizes.yaml", []byte("nodes: 3\n"), 0644)
+	os.WriteFile("stacks/files/zones.json", []byte(`["a", "b"]`), 0644)
+	os.WriteFile("stacks/dev.stack.js", []byte(`
+stack('dev', {})
+component('app', 'modules/app', {
+  motd: file('./files/motd.txt'),
+  user_data: templatefile('./files/user-data.sh', { name: 'app', db: { port: 5432 } }),
+  nodes: yaml('./files/sizes.yaml').nodes,
+  zones: json('./files/zones.json')
+})
+`), 0644)
+
+	vm, _ := NewInterpreter()
+	stack, err := vm.Parse("stacks/dev.stack.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app, _ := stack.GetComponent("app")
+	if app.Inputs["motd"] != "hello" || (app.Inputs["nodes"] != int64(3) && app.Inputs["nodes"] != float64(3)) {
+		t.Errorf("inputs = %v", app.Inputs)
+	}
+	// ${} is replaced, {{ }} is left for the templater
+	if app.Inputs["user_data"] != "echo app 5432 {{ .stack }}" {
+		t.Errorf("user_data = %v", app.Inputs["user_data"])
+	}
+	if zones, ok := app.Inputs["zones"].([]interface{}); !ok || len(zones) != 2 {
+		t.Errorf("zones = %v", app.Inputs["zones"])
+	}
+
+	// files read by the stack invalidate its cached bundle
+	if _, ok := Lookup("stacks/dev.stack.js"); !ok {
+		t.Fatal("bundle not cached")
+	}
+	os.WriteFile("stacks/files/sizes.yaml", []byte("nodes: 6\n"), 0644)
+	if _, ok := Lookup("stacks/dev.stack.js"); ok {
+		t.Error("bundle still cached after a file read by the stack changed")
+	}
+
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	os.WriteFile(outside, []byte("secret"), 0644)
+	os.Symlink(outside, "stacks/files/link.txt")
+
+	tests := map[string]string{
+		`templatefile('./files/user-data.sh', { name: 'app' })`: "templatefile ./files/user-data.sh: no value for db.port",
+		`file('../../outside.txt')`:                             "is outside of the repository root",
+		`file('` + outside + `')`:                               "is outside of the repository root",
+		`file('./files/link.txt')`:                              "is outside of the repository root",
+	}
+
+	for src, want := range tests {
+		os.WriteFile("stacks/bad.stack.js", []byte("stack('bad', {}); component('x', 'm', { v: "+src+" })"), 0644)
+		vm, _ := NewInterpreter()
+		_, err := vm.Parse("stacks/bad.stack.js")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error = %v, want %s", src, err, want)
+		}
+	}
+}
+
+func TestVarsOrder(t *testing.T) {
+	for name, src := range map[string]string{
+		"vars first": `
+vars('./vars.yaml')
+stack('dev', { region: 'eu-west-1', db: { tier: 'large' } })
+vars('./more.yaml')
+`,
+		"stack first": `
+stack('dev', { region: 'eu-west-1', db: { tier: 'large' } })
+vars('./vars.yaml', './more.yaml')
+`,
+	} {
+		dir := t.TempDir()
+		wd, _ := os.Getwd()
+		os.Chdir(dir)
+
+		os.WriteFile("vars.yaml", []byte("region: us-east-1\ndb: { tier: small, size: 10 }\nzone: a\n"), 0644)
+		os.WriteFile("more.yaml", []byte("zone: b\n"), 0644)
+		os.WriteFile("dev.stack.js", []byte(src+"component('app', 'modules/app', {})\n"), 0644)
+
+		vm, _ := NewInterpreter()
+		stack, err := vm.Parse("dev.stack.js")
+		os.Chdir(wd)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		// stack() options override vars() files, later files override earlier ones
+		opts := stack.Options.(map[string]interface{})
+		db := opts["db"].(map[string]interface{})
+		if opts["region"] != "eu-west-1" || db["tier"] != "large" || db["size"] != float64(10) || opts["zone"] != "b" {
+			t.Errorf("%s: options = %v", name, opts)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package js
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/dop251/goja"
+)
+
+var (
+	identRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// transformations available on references, mapped to template functions
+	refTransforms = map[string]string{
+		"split":       "split",
+		"join":        "join",
+		"replace":     "replace",
+		"lower":       "lower",
+		"upper":       "upper",
+		"toLowerCase": "lower",
+		"toUpperCase": "upper",
+	}
+)
+
+// ref is a reference to a component output, or a value derived from it,
+// it renders to a template expression resolved when the stack runs
+type ref struct {
+	expr string // template operand, e.g. (state "dev" "vpc").subnets
+}
+
+func (r *ref) String() string {
+	return "{{ " + r.expr + " }}"
+}
+
+// attr references a nested attribute of the value
+func (r *ref) attr(name string) *ref {
+	if identRe.MatchString(name) {
+		return &ref{expr: r.expr + "." + name}
+	}
+	return &ref{expr: "(index " + r.expr + " " + strconv.Quote(name) + ")"}
+}
+
+// index references an element of a list value
+func (r *ref) index(i int) *ref {
+	return &ref{expr: "(index " + r.expr + " " + strconv.Itoa(i) + ")"}
+}
+
+// pipe passes the value through a template function as last argument
+func (r *ref) pipe(fn string, args ...goja.Value) *ref {
+	expr := "(" + r.expr + " | " + fn
+	for _, a := range args {
+		expr += " " + strconv.Quote(a.String())
+	}
+	return &ref{expr: expr + ")"}
+}
+
+// newRef wraps a reference in a JS proxy supporting property access,
+// indexing, transformations and string conversion
+func (vm *jsinterpreter) newRef(r *ref) goja.Value {
+	str := func(goja.FunctionCall) goja.Value {
+		return vm.rt.ToValue(r.String())
+	}
+
+	proxy := vm.rt.NewProxy(vm.rt.NewObject(), &goja.ProxyTrapConfig{
+		Get: func(target *goja.Object, property string, receiver goja.Value) goja.Value {
+			switch property {
+			case "toString", "valueOf", "toJSON":
+				return vm.rt.ToValue(str)
+			}
+			if fn, ok := refTransforms[property]; ok {
+				return vm.rt.ToValue(func(call goja.FunctionCall) goja.Value {
+					return vm.newRef(r.pipe(fn, call.Arguments...))
+				})
+			}
+			if i, err := strconv.Atoi(property); err == nil && i >= 0 {
+				return vm.newRef(r.index(i))
+			}
+			return vm.newRef(r.attr(property))
+		},
+		GetIdx: func(target *goja.Object, property int, receiver goja.Value) goja.Value {
+			return vm.newRef(r.index(property))
+		},
+		GetSym: func(target *goja.Object, property *goja.Symbol, receiver goja.Value) goja.Value {
+			return goja.Undefined()
+		},
+	})
+
+	v := vm.rt.ToValue(proxy)
+	vm.refs[v.(*goja.Object)] = r
+	return v
+}
+
+// export converts a JS value to Go, rendering references to their
+// template expressions
+func (vm *jsinterpreter) export(v goja.Value) any {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil
+	}
+
+	obj, ok := v.(*goja.Object)
+	if !ok {
+		return v.Export()
+	}
+
+	if r, ok := vm.refs[obj]; ok {
+		return r.String()
+	}
+
+	switch obj.ClassName() {
+	case "Array":
+		keys := obj.Keys()
+		res := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			res = append(res, vm.export(obj.Get(k)))
+		}
+		return res
+	case "Object":
+		if _, isProxy := obj.Export().(goja.Proxy); isProxy {
+			return obj.Export()
+		}
+		res := make(map[string]interface{}, len(obj.Keys()))
+		for _, k := range obj.Keys() {
+			res[k] = vm.export(obj.Get(k))
+		}
+		return res
+	}
+
+	return obj.Export()
+}
+
+// exportMap exports a JS object to a Go map
+func (vm *jsinterpreter) exportMap(v goja.Value) map[string]interface{} {
+	m, ok := vm.export(v).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return m
+}
+
+// get returns a property of a JS object, or nil if v is not an object
+func (vm *jsinterpreter) get(v goja.Value, name string) goja.Value {
+	obj, ok := v.(*goja.Object)
+	if !ok {
+		return nil
+	}
+	return obj.Get(name)
+}
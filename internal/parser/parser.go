@@ -1,76 +1,388 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bmatcuk/doublestar/v4"
 
 	"github.com/moonwalker/comet/internal/log"
+	"github.com/moonwalker/comet/internal/modules"
 	"github.com/moonwalker/comet/internal/parser/js"
+	"github.com/moonwalker/comet/internal/parser/yaml"
 	"github.com/moonwalker/comet/internal/schema"
 )
 
 const (
-	errNoLoader = "unsupported extension: '%s', no loader found"
+	errNoLoader  = "unsupported extension: '%s', no loader found"
+	errDuplicate = "stack %s is declared in both %s and %s"
 )
 
 var (
 	jsextensions = []string{
 		".js", ".ts",
 	}
-	extensions  = slices.Concat(jsextensions)
-	globpattern = "**/*{" + strings.Join(extensions, ",") + "}"
+	// yaml files are only stacks when named *.stack.yaml, stacks dirs
+	// commonly hold other yaml files like encrypted secrets
+	yamlextensions = []string{
+		".yaml", ".yml",
+	}
+	extensions  = slices.Concat(jsextensions, yamlextensions)
+	globpattern = "**/*{" + strings.Join(slices.Concat(jsextensions, stackSuffixes(yamlextensions)), ",") + "}"
+
+	// maximum number of stack files parsed at the same time
+	workers = runtime.NumCPU()
+)
+
+type (
+	parseResult struct {
+		stack *schema.Stack
+		err   error
+	}
+
+	// FileError is a stack file that failed to parse
+	FileError struct {
+		Path string
+		Err  error
+	}
 )
 
+func (e *FileError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// LoadStacks parses every stack file in dir
 func LoadStacks(dir string) (*schema.Stacks, error) {
 	start := time.Now()
 	log.Debug("LoadStacks started", "dir", dir)
 
 	stacks := &schema.Stacks{}
 
-	err := doublestar.GlobWalk(os.DirFS(dir), globpattern, func(p string, d fs.DirEntry) error {
-		// Skip TypeScript definition files
-		if strings.HasSuffix(p, ".d.ts") {
-			return nil
+	files, err := stackFiles(dir)
+	if err != nil {
+		return stacks, err
+	}
+
+	err = addStacks(stacks, parseFiles(files))
+	if err == nil {
+		idx := &index{Dir: dir, Stacks: map[string]*indexEntry{}}
+		idx.update(stacks)
+		idx.save()
+
+		// every stack is known, so refs no component uses can be dropped
+		err = modules.PruneLock(componentPaths(stacks))
+	}
+
+	totalTime := time.Since(start)
+	log.Debug("LoadStacks completed", "total_duration", totalTime)
+
+	return stacks, err
+}
+
+func componentPaths(stacks *schema.Stacks) []string {
+	paths := []string{}
+	for _, s := range stacks.OrderByName() {
+		for _, c := range s.Components {
+			paths = append(paths, c.Path)
 		}
+	}
+	return paths
+}
 
-		path := filepath.Join(dir, p)
-		fileStart := time.Now()
-		log.Debug("Parsing stack file", "path", p)
+// ParseAll parses every stack file in dir without stopping at the first
+// failure, returning the valid stacks and the errors of the failing files
+func ParseAll(dir string) ([]*schema.Stack, []*FileError, error) {
+	files, err := stackFiles(dir)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		parser, err := getParser(path)
-		if err != nil {
-			return err
+	var stacks []*schema.Stack
+	var errs []*FileError
+	for i, r := range parseFiles(files) {
+		if r.err != nil {
+			errs = append(errs, &FileError{Path: files[i], Err: r.err})
+			continue
+		}
+		if r.stack.Valid() {
+			stacks = append(stacks, r.stack)
 		}
-		parserTime := time.Since(fileStart)
-		log.Debug("getParser completed", "path", p, "duration", parserTime)
+	}
+
+	return stacks, errs, nil
+}
+
+// StackFile returns the file declaring the named stack according to the stack
+// index or the naming convention, which still finds files that fail to parse
+func StackFile(dir string, name string) string {
+	if p := loadIndex(dir).lookup(name); len(p) > 0 {
+		return p
+	}
+	return conventionPath(dir, name)
+}
+
+// LoadStack parses only the files needed for the named stack: the file
+// declaring it and the files of the stacks it references through state.
+// Files are found through the stack index or the <stack>.stack.js naming
+// convention, falling back to a scan of all files when the index is stale.
+func LoadStack(dir string, name string) (*schema.Stacks, error) {
+	start := time.Now()
+	log.Debug("LoadStack started", "dir", dir, "stack", name)
+
+	idx := loadIndex(dir)
+
+	stacks, err := loadIndexed(dir, name, idx)
+	if errors.Is(err, errStaleIndex) {
+		log.Debug("stack index stale, scanning stack files", "stack", name, "reason", err)
+		stacks, err = scanStack(dir, name)
+	}
+	if err != nil {
+		return stacks, err
+	}
+
+	idx.update(stacks)
+	idx.save()
+
+	log.Debug("LoadStack completed", "stack", name, "total_duration", time.Since(start))
+
+	return stacks, nil
+}
+
+// loadIndexed resolves the named stack and its references to files without
+// looking at any other stack file
+func loadIndexed(dir string, name string, idx *index) (*schema.Stacks, error) {
+	stacks := &schema.Stacks{}
+
+	loaded := []string{}
+	queue := []string{name}
+
+	for len(queue) > 0 {
+		paths := make([]string, len(queue))
+		for i, n := range queue {
+			paths[i] = idx.lookup(n)
+			if len(paths[i]) == 0 {
+				paths[i] = conventionPath(dir, n)
+			}
+			if len(paths[i]) == 0 {
+				return stacks, fmt.Errorf("%w: no file for stack %s", errStaleIndex, n)
+			}
+		}
+		loaded = append(loaded, queue...)
+
+		results := parseFiles(paths)
+
+		var next []string
+		for i, r := range results {
+			if r.err != nil {
+				return stacks, r.err
+			}
+			if !r.stack.Valid() || r.stack.Name != queue[i] {
+				return stacks, fmt.Errorf("%w: %s declares %s, not %s", errStaleIndex, paths[i], r.stack.Name, queue[i])
+			}
+
+			err := stacks.AddStack(r.stack)
+			if err != nil {
+				return stacks, err
+			}
+
+			for _, ref := range r.stack.References() {
+				if !slices.Contains(loaded, ref) && !slices.Contains(next, ref) {
+					next = append(next, ref)
+				}
+			}
+		}
+
+		queue = next
+	}
+
+	return stacks, duplicates(dir, stacks)
+}
 
-		parseStart := time.Now()
-		stack, err := parser.Parse(path)
+// duplicates reports another stack file declaring one of the loaded stacks,
+// as far as the bundle cache knows the stacks of the other files, files that
+// were never parsed are only checked by the scan when the index is rebuilt
+func duplicates(dir string, stacks *schema.Stacks) error {
+	files, err := stackFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		b, ok := js.Lookup(path)
+		if !ok {
+			continue
+		}
+		s, err := stacks.GetStack(b.Stack)
+		if err != nil || filepath.Clean(s.Path) == filepath.Clean(path) {
+			continue
+		}
+		return fmt.Errorf(errDuplicate, s.Name, s.Path, path)
+	}
+
+	return nil
+}
+
+// scanStack walks all stack files, skipping the ones whose bundle is cached
+// and unchanged when they declare a stack that is not needed
+func scanStack(dir string, name string) (*schema.Stacks, error) {
+	stacks := &schema.Stacks{}
+
+	files, err := stackFiles(dir)
+	if err != nil {
+		return stacks, err
+	}
+
+	needed := []string{name}
+	pending := files
+
+	for len(pending) > 0 {
+		var parse, skipped []string
+		for _, path := range pending {
+			if b, ok := js.Lookup(path); ok && !slices.Contains(needed, b.Stack) {
+				skipped = append(skipped, path)
+				continue
+			}
+			parse = append(parse, path)
+		}
+
+		if len(parse) == 0 {
+			break
+		}
+
+		results := parseFiles(parse)
+		err = addStacks(stacks, results)
 		if err != nil {
-			log.Debug("Parse failed", "path", p, "error", err, "duration", time.Since(parseStart))
-			return err
+			return stacks, err
 		}
-		parseTime := time.Since(parseStart)
-		log.Debug("Parse completed", "path", p, "duration", parseTime)
 
-		if stack.Valid() {
-			return stacks.AddStack(stack)
+		for _, r := range results {
+			if r.stack != nil && slices.Contains(needed, r.stack.Name) {
+				for _, ref := range r.stack.References() {
+					if !slices.Contains(needed, ref) {
+						needed = append(needed, ref)
+					}
+				}
+			}
 		}
 
+		pending = skipped
+	}
+
+	_, err = stacks.GetStack(name)
+	return stacks, err
+}
+
+func stackFiles(dir string) ([]string, error) {
+	files := []string{}
+
+	err := doublestar.GlobWalk(os.DirFS(dir), globpattern, func(p string, d fs.DirEntry) error {
+		// Skip TypeScript definition files
+		if strings.HasSuffix(p, ".d.ts") {
+			return nil
+		}
+
+		files = append(files, filepath.Join(dir, p))
 		return nil
 	})
 
-	totalTime := time.Since(start)
-	log.Debug("LoadStacks completed", "total_duration", totalTime)
+	return files, err
+}
 
-	return stacks, err
+// stackSuffixes prefixes extensions with .stack
+func stackSuffixes(exts []string) []string {
+	res := make([]string, len(exts))
+	for i, ext := range exts {
+		res[i] = ".stack" + ext
+	}
+	return res
+}
+
+// conventionPath finds a <stack>.stack.js, .ts, .yaml or .yml file in dir
+func conventionPath(dir string, name string) string {
+	matches, err := doublestar.Glob(os.DirFS(dir), "**/"+name+".stack{"+strings.Join(extensions, ",")+"}")
+	if err != nil || len(matches) != 1 {
+		return ""
+	}
+	return filepath.Join(dir, matches[0])
+}
+
+// parseFiles parses files with a bounded pool of workers, results are
+// returned in the order of files
+func parseFiles(files []string) []parseResult {
+	results := make([]parseResult, len(files))
+
+	sem := make(chan struct{}, max(workers, 1))
+	var wg sync.WaitGroup
+
+	for i, path := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			stack, err := parseFile(path)
+			results[i] = parseResult{stack, err}
+		}()
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+func parseFile(path string) (*schema.Stack, error) {
+	fileStart := time.Now()
+	log.Debug("Parsing stack file", "path", path)
+
+	parser, err := getParser(path)
+	if err != nil {
+		return nil, err
+	}
+	parserTime := time.Since(fileStart)
+	log.Debug("getParser completed", "path", path, "duration", parserTime)
+
+	parseStart := time.Now()
+	stack, err := parser.Parse(path)
+	if err != nil {
+		log.Debug("Parse failed", "path", path, "error", err, "duration", time.Since(parseStart))
+		return nil, err
+	}
+	parseTime := time.Since(parseStart)
+	log.Debug("Parse completed", "path", path, "duration", parseTime)
+
+	return stack, nil
+}
+
+// addStacks adds the valid parsed stacks, stopping at the first error
+func addStacks(stacks *schema.Stacks, results []parseResult) error {
+	for _, r := range results {
+		if r.err != nil {
+			return r.err
+		}
+
+		if r.stack.Valid() {
+			err := stacks.AddStack(r.stack)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
 }
 
 func getParser(path string) (schema.Parser, error) {
@@ -79,6 +391,8 @@ func getParser(path string) (schema.Parser, error) {
 	switch {
 	case slices.Contains(jsextensions, ext):
 		return js.NewInterpreter()
+	case slices.Contains(yamlextensions, ext):
+		return yaml.NewParser(), nil
 	}
 
 	return nil, fmt.Errorf(errNoLoader, ext)
@@ -0,0 +1,204 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// chdir switches into a fresh temp dir, so the bundle cache lands there
+func chdir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	return dir
+}
+
+func writeStack(t *testing.T, dir, name, src string) {
+	t.Helper()
+
+	err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadStacks(t *testing.T) {
+	dir := chdir(t)
+	for i, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		writeStack(t, dir, name+".stack.js", `
+stack('`+name+`', {})
+component('c`+string(rune('0'+i))+`', 'modules/x', {})
+`)
+	}
+
+	stacks, err := LoadStacks(dir)
+	if err != nil {
+		t.Fatalf("LoadStacks() error = %v", err)
+	}
+
+	got := stacks.OrderByName()
+	if len(got) != 6 {
+		t.Fatalf("LoadStacks() returned %d stacks, want 6", len(got))
+	}
+	for i, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		if got[i].Name != name {
+			t.Errorf("stack[%d] = %s, want %s", i, got[i].Name, name)
+		}
+	}
+}
+
+func TestLoadStacksDuplicate(t *testing.T) {
+	dir := chdir(t)
+	writeStack(t, dir, "a.stack.js", `stack('dup', {}); component('x', 'm', {})`)
+	writeStack(t, dir, "b.stack.js", `stack('dup', {}); component('y', 'm', {})`)
+
+	_, err := LoadStacks(dir)
+	if err == nil {
+		t.Fatal("LoadStacks() expected duplicate stack error")
+	}
+}
+
+func TestLoadStacksMixed(t *testing.T) {
+	dir := chdir(t)
+	writeStack(t, dir, "dev.stack.js", `stack('dev', {}); component('app', 'modules/app', {})`)
+	writeStack(t, dir, "shared.stack.yaml", "stack: shared\ncomponents:\n  - name: vpc\n    source: modules/vpc\n")
+	writeStack(t, dir, "secrets.enc.yaml", "sops: {}\n")
+
+	stacks, err := LoadStacks(dir)
+	if err != nil {
+		t.Fatalf("LoadStacks() error = %v", err)
+	}
+
+	got := stacks.OrderByName()
+	if len(got) != 2 || got[0].Name != "dev" || got[1].Name != "shared" || got[1].Type != "yaml" {
+		t.Fatalf("LoadStacks() = %v, want dev and yaml shared", got)
+	}
+
+	if conventionPath(dir, "shared") != filepath.Join(dir, "shared.stack.yaml") {
+		t.Errorf("conventionPath(shared) = %s", conventionPath(dir, "shared"))
+	}
+}
+
+func TestLoadStack(t *testing.T) {
+	dir := chdir(t)
+	writeStack(t, dir, "dev.stack.js", `
+stack('dev', {})
+component('app', 'modules/app', { vpc: '{{ (state "shared" "vpc").id }}' })
+`)
+	writeStack(t, dir, "network.stack.js", `
+stack('shared', {})
+component('vpc', 'modules/vpc', {})
+`)
+	writeStack(t, dir, "other.stack.js", `
+stack('other', {})
+component('db', 'modules/db', {})
+`)
+	// a broken file of an unrelated stack must not block others
+	writeStack(t, dir, "broken.stack.js", `stack('broken', {`)
+
+	// shared does not follow the naming convention and is not indexed yet,
+	// so the first run falls back to scanning
+	_, err := LoadStack(dir, "dev")
+	if err == nil {
+		t.Fatal("LoadStack() expected scan to hit the broken file")
+	}
+
+	os.Remove(filepath.Join(dir, "broken.stack.js"))
+	_, err = LoadStack(dir, "dev")
+	if err != nil {
+		t.Fatalf("LoadStack() error = %v", err)
+	}
+
+	writeStack(t, dir, "broken.stack.js", `stack('broken', {`)
+
+	// indexed run only loads dev and the stacks it references
+	stacks, err := LoadStack(dir, "dev")
+	if err != nil {
+		t.Fatalf("LoadStack() error = %v", err)
+	}
+	for _, name := range []string{"dev", "shared"} {
+		if _, err := stacks.GetStack(name); err != nil {
+			t.Errorf("LoadStack() missing stack %s", name)
+		}
+	}
+	if _, err := stacks.GetStack("other"); err == nil {
+		t.Errorf("LoadStack() parsed unrelated stack other")
+	}
+
+	// the naming convention works without an index
+	stacks, err = LoadStack(dir, "other")
+	if err != nil {
+		t.Fatalf("LoadStack() error = %v", err)
+	}
+	if len(stacks.OrderByName()) != 1 {
+		t.Errorf("LoadStack() returned %d stacks, want 1", len(stacks.OrderByName()))
+	}
+}
+
+func TestLoadStackStaleIndex(t *testing.T) {
+	dir := chdir(t)
+	writeStack(t, dir, "a.stack.js", `stack('one', {}); component('x', 'm', {})`)
+
+	_, err := LoadStack(dir, "one")
+	if err != nil {
+		t.Fatalf("LoadStack() error = %v", err)
+	}
+
+	// the stack moved to another file, the index entry is stale
+	writeStack(t, dir, "a.stack.js", `stack('two', {}); component('x', 'm', {})`)
+	writeStack(t, dir, "b.stack.js", `stack('one', {}); component('y', 'm', {})`)
+
+	stacks, err := LoadStack(dir, "one")
+	if err != nil {
+		t.Fatalf("LoadStack() error = %v", err)
+	}
+	s, err := stacks.GetStack("one")
+	if err != nil {
+		t.Fatalf("LoadStack() missing stack one")
+	}
+	if filepath.Base(s.Path) != "b.stack.js" {
+		t.Errorf("LoadStack() loaded one from %s, want b.stack.js", s.Path)
+	}
+}
+
+func TestLoadStackDuplicate(t *testing.T) {
+	dir := chdir(t)
+	writeStack(t, dir, "dev.stack.js", `stack('dev', {}); component('app', 'modules/app', {})`)
+
+	_, err := LoadStack(dir, "dev")
+	if err != nil {
+		t.Fatalf("LoadStack() error = %v", err)
+	}
+
+	// the index points at dev.stack.js, a full scan rebuilding it reports
+	// the second file and caches what it declares
+	writeStack(t, dir, "copy.stack.js", `stack('dev', {}); component('db', 'modules/db', {})`)
+	_, err = LoadStacks(dir)
+	if err == nil || !strings.Contains(err.Error(), "stack already exists: dev") {
+		t.Fatalf("LoadStacks() error = %v, want duplicate", err)
+	}
+
+	_, err = LoadStack(dir, "dev")
+	if err == nil || !strings.Contains(err.Error(), "stack dev is declared in both") {
+		t.Errorf("indexed LoadStack() error = %v, want duplicate", err)
+	}
+
+	// without the index the scan fallback parses both files
+	os.Remove(indexFile)
+	os.Rename(filepath.Join(dir, "dev.stack.js"), filepath.Join(dir, "main.stack.js"))
+	_, err = LoadStack(dir, "dev")
+	if err == nil || !strings.Contains(err.Error(), "stack already exists: dev") {
+		t.Errorf("scanned LoadStack() error = %v, want duplicate", err)
+	}
+}
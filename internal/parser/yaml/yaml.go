@@ -0,0 +1,391 @@
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	yamlv3 "gopkg.in/yaml.v3"
+
+	"github.com/moonwalker/comet/internal/log"
+	"github.com/moonwalker/comet/internal/schema"
+	"github.com/moonwalker/comet/internal/secrets"
+)
+
+const (
+	errParse      = "%s: %w"
+	errNoName     = "component %d has no name"
+	errNoSource   = "component %s has no source"
+	errCustom     = "metadata.custom must be a mapping"
+	errHooks      = "hooks must be a mapping"
+	errLabelValue = "label %s must be a string, number or boolean"
+	errHookEvent  = "unknown hook event: %s"
+	errHookValue  = "hook %s must be a command or { run, optional }"
+)
+
+type (
+	yamlparser struct{}
+
+	// document is the layout of a .stack.yaml file, it mirrors the
+	// functions available to JS stack files
+	document struct {
+		Stack      string              `yaml:"stack"`
+		Options    map[string]any      `yaml:"options"`
+		Metadata   *metadata           `yaml:"metadata"`
+		Backend    *backend            `yaml:"backend"`
+		Envs       map[string]string   `yaml:"envs"`
+		Appends    map[string][]string `yaml:"appends"`
+		Kubeconfig yamlv3.Node         `yaml:"kubeconfig"`
+		Hooks      yamlv3.Node         `yaml:"hooks"`
+		Versions   map[string]any      `yaml:"versions"`
+		Generate   map[string]any      `yaml:"generate"`
+		Components []*component        `yaml:"components"`
+	}
+
+	metadata struct {
+		Description string      `yaml:"description"`
+		Owner       string      `yaml:"owner"`
+		Tags        []string    `yaml:"tags"`
+		Custom      yamlv3.Node `yaml:"custom"`
+		Protected   bool        `yaml:"protected"`
+	}
+
+	backend struct {
+		Type   string         `yaml:"type"`
+		Config map[string]any `yaml:"config"`
+	}
+
+	component struct {
+		Name      string         `yaml:"name"`
+		Source    string         `yaml:"source"`
+		Inputs    map[string]any `yaml:"inputs"`
+		Providers map[string]any `yaml:"providers"`
+		Hooks     yamlv3.Node    `yaml:"hooks"`
+		Protect   bool           `yaml:"protect"`
+		Enabled   *bool          `yaml:"enabled"`
+		Labels    map[string]any `yaml:"labels"`
+
+		MockOutputs        map[string]any `yaml:"mock_outputs"`
+		MockOutputsAllowed []string       `yaml:"mock_outputs_allowed"`
+		Versions           map[string]any `yaml:"versions"`
+		Generate           map[string]any `yaml:"generate"`
+	}
+)
+
+func NewParser() *yamlparser {
+	return &yamlparser{}
+}
+
+func (p *yamlparser) Parse(path string) (*schema.Stack, error) {
+	log.Debug("YAML Parse started", "path", path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &document{}
+	dec := yamlv3.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(doc)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf(errParse, path, err)
+	}
+
+	stack, err := doc.stack(path)
+	if err != nil {
+		return nil, fmt.Errorf(errParse, path, err)
+	}
+
+	return stack, nil
+}
+
+// stack builds the stack the same way the JS functions do, backend and
+// appends come first since components copy them when added
+func (d *document) stack(path string) (*schema.Stack, error) {
+	stack := schema.NewStack(path, "yaml")
+	stack.Name = d.Stack
+	stack.Options = normalizeMap(d.Options)
+
+	hooks, err := parseHooks(&d.Hooks)
+	if err != nil {
+		return nil, err
+	}
+	stack.Hooks = hooks
+
+	if d.Metadata != nil {
+		stack.Metadata, err = d.Metadata.schema()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if d.Backend != nil {
+		stack.Backend = schema.Backend{Type: d.Backend.Type, Config: normalizeMap(d.Backend.Config)}
+	}
+
+	for k, lines := range d.Appends {
+		stack.Appends[k] = lines
+	}
+
+	if d.Versions != nil {
+		stack.Versions, err = schema.ParseVersions(normalizeMap(d.Versions))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if d.Generate != nil {
+		stack.Generate, err = schema.ParseGenerates(normalizeMap(d.Generate))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for k, v := range d.Envs {
+		// secret references are resolved like secrets() in JS stack files
+		if secrets.IsRef(v) {
+			v, err = secrets.Get(v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		stack.Envs[k] = v
+	}
+
+	if !d.Kubeconfig.IsZero() {
+		stack.Kubeconfig, err = kubeconfig(&d.Kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, c := range d.Components {
+		err = c.add(stack, i)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stack, nil
+}
+
+func (c *component) add(stack *schema.Stack, i int) error {
+	if len(c.Name) == 0 {
+		return fmt.Errorf(errNoName, i)
+	}
+	if len(c.Source) == 0 {
+		return fmt.Errorf(errNoSource, c.Name)
+	}
+
+	log.Debug("register component", "name", c.Name, "stack", stack.Name)
+
+	hooks, err := parseHooks(&c.Hooks)
+	if err != nil {
+		return err
+	}
+
+	labels, err := labelsMap(c.Labels)
+	if err != nil {
+		return err
+	}
+
+	inputs := normalizeMap(c.Inputs)
+	if inputs == nil {
+		inputs = make(map[string]interface{})
+	}
+
+	comp := stack.AddComponent(c.Name, c.Source, inputs, normalizeMap(c.Providers))
+	comp.Hooks = hooks
+	comp.Protect = c.Protect
+	comp.Disabled = c.Enabled != nil && !*c.Enabled
+	comp.Labels = labels
+	comp.MockOutputs = normalizeMap(c.MockOutputs)
+	comp.MockOutputsAllowed = c.MockOutputsAllowed
+
+	err = schema.CheckMockOps(c.MockOutputsAllowed)
+	if err != nil {
+		return err
+	}
+
+	if c.Versions != nil {
+		comp.Versions, err = schema.ParseVersions(normalizeMap(c.Versions))
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Generate != nil {
+		comp.Generate, err = schema.ParseGenerates(normalizeMap(c.Generate))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *metadata) schema() (*schema.Metadata, error) {
+	md := &schema.Metadata{
+		Description: m.Description,
+		Owner:       m.Owner,
+		Tags:        m.Tags,
+		Protected:   m.Protected,
+	}
+
+	if m.Custom.IsZero() {
+		return md, nil
+	}
+	if m.Custom.Kind != yamlv3.MappingNode {
+		return nil, errors.New(errCustom)
+	}
+
+	// custom fields are kept as ordered key/value pairs, like in JS
+	custom := make([]interface{}, 0, len(m.Custom.Content))
+	for i := 0; i+1 < len(m.Custom.Content); i += 2 {
+		var v any
+		err := m.Custom.Content[i+1].Decode(&v)
+		if err != nil {
+			return nil, err
+		}
+		custom = append(custom, m.Custom.Content[i].Value, normalize(v))
+	}
+	md.Custom = custom
+
+	return md, nil
+}
+
+// kubeconfig decodes through JSON, so the keys match the JS kubeconfig()
+func kubeconfig(node *yamlv3.Node) (*schema.Kubeconfig, error) {
+	var v any
+	err := node.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+
+	jb, err := json.Marshal(normalize(v))
+	if err != nil {
+		return nil, err
+	}
+
+	k := &schema.Kubeconfig{}
+	err = json.Unmarshal(jb, k)
+	if err != nil {
+		return nil, fmt.Errorf("kubeconfig: %w", err)
+	}
+
+	return k, nil
+}
+
+// parseHooks converts a hooks mapping, each event takes a shell command,
+// { run, optional } or a list of those
+func parseHooks(node *yamlv3.Node) (schema.Hooks, error) {
+	if node.IsZero() {
+		return nil, nil
+	}
+	if node.Kind != yamlv3.MappingNode {
+		return nil, errors.New(errHooks)
+	}
+
+	hooks := schema.Hooks{}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		event, val := node.Content[i].Value, node.Content[i+1]
+		if !schema.ValidHookEvent(event) {
+			return nil, fmt.Errorf(errHookEvent, event)
+		}
+
+		items := []*yamlv3.Node{val}
+		if val.Kind == yamlv3.SequenceNode {
+			items = val.Content
+		}
+
+		for _, item := range items {
+			h, err := parseHook(event, item)
+			if err != nil {
+				return nil, err
+			}
+			hooks[event] = append(hooks[event], h)
+		}
+	}
+
+	return hooks, nil
+}
+
+func parseHook(event string, node *yamlv3.Node) (*schema.Hook, error) {
+	switch node.Kind {
+	case yamlv3.ScalarNode:
+		if len(node.Value) > 0 {
+			return &schema.Hook{Command: node.Value}, nil
+		}
+	case yamlv3.MappingNode:
+		h := &struct {
+			Run      string `yaml:"run"`
+			Optional bool   `yaml:"optional"`
+		}{}
+		if err := node.Decode(h); err == nil && len(h.Run) > 0 {
+			return &schema.Hook{Command: h.Run, Optional: h.Optional}, nil
+		}
+	}
+
+	return nil, fmt.Errorf(errHookValue, event)
+}
+
+// labelsMap converts component labels, values must be scalars since
+// selectors compare them as text
+func labelsMap(m map[string]any) (map[string]string, error) {
+	if m == nil {
+		return nil, nil
+	}
+
+	labels := make(map[string]string, len(m))
+	for k, v := range m {
+		switch v.(type) {
+		case string, bool, int, float64:
+			labels[k] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf(errLabelValue, k)
+		}
+	}
+
+	return labels, nil
+}
+
+// normalize converts decoded YAML values to the types JS values export to,
+// integers become int64 and mappings map[string]interface{}
+func normalize(v any) any {
+	switch t := v.(type) {
+	case int:
+		return int64(t)
+	case map[string]interface{}:
+		return normalizeMap(t)
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, mv := range t {
+			m[fmt.Sprint(k)] = normalize(mv)
+		}
+		return m
+	case []interface{}:
+		res := make([]interface{}, len(t))
+		for i, e := range t {
+			res[i] = normalize(e)
+		}
+		return res
+	}
+	return v
+}
+
+func normalizeMap(m map[string]any) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[k] = normalize(v)
+	}
+	return res
+}
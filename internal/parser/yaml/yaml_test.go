@@ -0,0 +1,213 @@
+package yaml
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/moonwalker/comet/internal/parser/js"
+	"github.com/moonwalker/comet/internal/schema"
+)
+
+const jsStack = `
+stack('dev', { region: 'eu-west-1', replicas: 2, hooks: { after_apply: 'echo done' } })
+
+metadata({
+  description: 'Development',
+  owner: 'platform',
+  tags: ['dev'],
+  custom: { zeta: 1, alpha: 'a' },
+})
+
+backend('gcs', { bucket: 'state', prefix: 'comet/{{ .stack }}/{{ .component }}' })
+
+envs({ TF_LOG: 'info' })
+
+append('providers', ['provider "google" {}'])
+
+versions({ tofu: '>= 1.8', providers: { google: { source: 'hashicorp/google', version: '~> 6.0' } } })
+
+kubeconfig({
+  current: 0,
+  clusters: [{ context: 'dev', host: 'https://gke', exec_args: ['a', 'b'] }],
+})
+
+const vpc = component('vpc', 'modules/vpc', {
+  inputs: { cidr: '10.0.0.0/16', ratio: 0.5, zones: ['a', 'b'] },
+  labels: { tier: 'network', critical: true },
+  protect: true,
+})
+
+component('gke', 'modules/gke', {
+  inputs: { network: vpc.id, nodes: { min: 1, max: 3 } },
+  providers: { google: { project: vpc.project } },
+  hooks: { before_plan: [{ run: 'true', optional: true }] },
+  enabled: false,
+  versions: { providers: { google: { version: '~> 6.10' } } },
+})
+`
+
+const yamlStack = `
+stack: dev
+options:
+  region: eu-west-1
+  replicas: 2
+hooks:
+  after_apply: echo done
+
+metadata:
+  description: Development
+  owner: platform
+  tags: [dev]
+  custom:
+    zeta: 1
+    alpha: a
+
+backend:
+  type: gcs
+  config:
+    bucket: state
+    prefix: comet/{{ .stack }}/{{ .component }}
+
+envs:
+  TF_LOG: info
+
+appends:
+  providers:
+    - provider "google" {}
+
+versions:
+  tofu: ">= 1.8"
+  providers:
+    google: { source: hashicorp/google, version: "~> 6.0" }
+
+kubeconfig:
+  current: 0
+  clusters:
+    - context: dev
+      host: https://gke
+      exec_args: [a, b]
+
+components:
+  - name: vpc
+    source: modules/vpc
+    inputs:
+      cidr: 10.0.0.0/16
+      ratio: 0.5
+      zones: [a, b]
+    labels:
+      tier: network
+      critical: true
+    protect: true
+
+  - name: gke
+    source: modules/gke
+    inputs:
+      network: '{{ (state "dev" "vpc").id }}'
+      nodes: { min: 1, max: 3 }
+    providers:
+      google:
+        project: '{{ (state "dev" "vpc").project }}'
+    hooks:
+      before_plan:
+        - run: "true"
+          optional: true
+    enabled: false
+    versions:
+      providers:
+        google: { version: "~> 6.10" }
+`
+
+func writeFile(t *testing.T, name, src string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(src), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestParseMatchesJS(t *testing.T) {
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	vm, err := js.NewInterpreter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := vm.Parse(writeFile(t, "dev.stack.js", jsStack))
+	if err != nil {
+		t.Fatalf("js Parse() error = %v", err)
+	}
+
+	got, err := NewParser().Parse(writeFile(t, "dev.stack.yaml", yamlStack))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if got.Type != "yaml" {
+		t.Errorf("Type = %s, want yaml", got.Type)
+	}
+	got.Path, got.Type = want.Path, want.Type
+
+	if !reflect.DeepEqual(got, want) {
+		gj, _ := json.MarshalIndent(got, "", "  ")
+		wj, _ := json.MarshalIndent(want, "", "  ")
+		t.Errorf("Parse() =\n%s\nwant\n%s", gj, wj)
+	}
+
+	gke, _ := got.GetComponent("gke")
+	if len(gke.Depends) != 1 || gke.Depends[0].Component != "vpc" {
+		t.Errorf("gke depends = %v, want vpc", gke.Depends)
+	}
+	if got.Versions == nil || got.Versions.Tofu != ">= 1.8" || gke.Versions == nil || gke.Versions.Providers["google"].Version != "~> 6.10" {
+		t.Errorf("versions = %+v, gke versions = %+v", got.Versions, gke.Versions)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"unknown field", "stack: dev\nbakend: {}\n", "field bakend not found"},
+		{"no name", "stack: dev\ncomponents:\n  - source: modules/x\n", "component 0 has no name"},
+		{"no source", "stack: dev\ncomponents:\n  - name: x\n", "component x has no source"},
+		{"hook event", "stack: dev\nhooks:\n  before_lunch: echo\n", "unknown hook event: before_lunch"},
+		{"hook value", "stack: dev\nhooks:\n  before_plan: [[echo]]\n", "hook before_plan must be"},
+		{"label value", "stack: dev\ncomponents:\n  - name: x\n    source: m\n    labels: { a: [1] }\n", "label a must be"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, "x.stack.yaml", tt.src)
+			_, err := NewParser().Parse(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.want)
+			}
+			if err != nil && !strings.HasPrefix(err.Error(), path) {
+				t.Errorf("Parse() error = %v, want path prefix", err)
+			}
+		})
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	stack, err := NewParser().Parse(writeFile(t, "empty.stack.yaml", ""))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if stack.Valid() {
+		t.Error("empty file parsed as a valid stack")
+	}
+}
+
+var _ schema.Parser = NewParser()
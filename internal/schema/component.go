@@ -1,31 +1,89 @@
 package schema
 
 import (
+	"encoding/json"
 	"fmt"
 	"path"
+	"regexp"
+	"slices"
 
 	cp "github.com/otiai10/copy"
+
+	"github.com/moonwalker/comet/internal/modules"
 )
 
 type (
 	Component struct {
-		Stack                string                 `json:"stack"`
-		Backend              Backend                `json:"backend"`
-		Appends              map[string][]string    `json:"appends"`
-		Name                 string                 `json:"name"`
-		Path                 string                 `json:"path"`
-		Inputs               map[string]interface{} `json:"inputs"`
-		Providers            map[string]interface{} `json:"providers"`
-		ProviderDependencies map[string]string      `json:"provider_dependencies,omitempty"` // component -> stack mapping for failed dependencies
+		Stack              string                  `json:"stack"`
+		Backend            Backend                 `json:"backend"`
+		Appends            map[string][]string     `json:"appends"`
+		Name               string                  `json:"name"`
+		Path               string                  `json:"path"`
+		Inputs             map[string]interface{}  `json:"inputs"`
+		Providers          map[string]interface{}  `json:"providers"`
+		RemoteStates       map[string]*RemoteState `json:"remote_states,omitempty"` // data sources read by providers for outputs that didn't resolve, by name
+		Depends            []Dependency            `json:"depends,omitempty"`       // components whose outputs are referenced
+		Hooks              Hooks                   `json:"hooks,omitempty"`
+		Protect            bool                    `json:"protect,omitempty"`              // refuse to destroy or replace its resources
+		Disabled           bool                    `json:"disabled,omitempty"`             // skipped by all operations, but still referenceable for validation
+		Labels             map[string]string       `json:"labels,omitempty"`               // matched by label selectors
+		MockOutputs        map[string]interface{}  `json:"mock_outputs,omitempty"`         // returned by state while the component has no outputs
+		MockOutputsAllowed []string                `json:"mock_outputs_allowed,omitempty"` // operations that may use the mock outputs, plan when empty
+		Mocked             []string                `json:"mocked,omitempty"`               // values resolved from mock outputs of other components
+		Versions           *Versions               `json:"versions,omitempty"`             // tofu and provider versions, merged with the stack versions
+		Generate           map[string]*Generate    `json:"generate,omitempty"`             // files written into the component directory, by name
+	}
+
+	Dependency struct {
+		Stack     string `json:"stack"`
+		Component string `json:"component"`
+	}
+
+	// RemoteState is a terraform_remote_state data source for the outputs of
+	// a component, configured with the backend of that component
+	RemoteState struct {
+		Stack     string  `json:"stack"`
+		Component string  `json:"component"`
+		Backend   Backend `json:"backend"`
 	}
 )
 
-// copy component to workdir if needed
+var (
+	stateCallRe  = regexp.MustCompile(`state\s+\\?"([^"\\]+)\\?"\s+\\?"([^"\\]+)\\?"`)
+	outputCallRe = regexp.MustCompile(`\boutput\s+\\?"([^"\\]+)\\?"\s+\\?"([^"\\]+)\\?"`)
+	stateAttrRe  = regexp.MustCompile(`\(state\s+\\?"([^"\\]+)\\?"\s+\\?"([^"\\]+)\\?"\)\.([A-Za-z0-9_-]+)`)
+	stateIndexRe = regexp.MustCompile(`index\s+\(state\s+\\?"([^"\\]+)\\?"\s+\\?"([^"\\]+)\\?"\)\s+\\?"([^"\\]+)\\?"`)
+)
+
+// copy component to workdir if needed, remote sources are always copied
+// out of the module cache so components never share a working directory
 func (c *Component) EnsurePath(config *Config, copy bool) error {
-	if len(config.WorkDir) > 0 {
-		dest := path.Join(config.WorkDir, c.Stack, c.Name)
+	src, workdir := c.Path, config.WorkDir
+	remote := modules.IsRemote(c.Path)
+
+	if remote {
+		if len(workdir) == 0 {
+			workdir = modules.WorkDir
+		}
+		if copy {
+			var err error
+			src, err = modules.Fetch(c.Path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(workdir) > 0 {
+		dest := path.Join(workdir, c.Stack, c.Name)
 		if copy {
-			err := cp.Copy(c.Path, dest)
+			var err error
+			if remote {
+				// replaces the files of an older checkout
+				err = modules.Copy(src, dest)
+			} else {
+				err = cp.Copy(src, dest)
+			}
 			if err != nil {
 				return err
 			}
@@ -35,47 +93,150 @@ func (c *Component) EnsurePath(config *Config, copy bool) error {
 	return nil
 }
 
+// template operand returning the outputs of the component
+func (c *Component) StateExpr() string {
+	return fmt.Sprintf(`(state "%s" "%s")`, c.Stack, c.Name)
+}
+
 // property ref template to resolve later
 func (c *Component) PropertyRef(property string) string {
-	return fmt.Sprintf(`{{ (state "%s" "%s").%s }}`, c.Stack, c.Name, property)
+	return fmt.Sprintf(`{{ %s.%s }}`, c.StateExpr(), property)
+}
+
+// FindDependencies collects the components referenced through state in v,
+// and through output for components of stack
+func FindDependencies(stack string, v ...any) []Dependency {
+	jb, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	deps := []Dependency{}
+	add := func(d Dependency) {
+		if !slices.Contains(deps, d) {
+			deps = append(deps, d)
+		}
+	}
+	for _, m := range stateCallRe.FindAllStringSubmatch(string(jb), -1) {
+		add(Dependency{Stack: m[1], Component: m[2]})
+	}
+	for _, m := range outputCallRe.FindAllStringSubmatch(string(jb), -1) {
+		add(Dependency{Stack: stack, Component: m[1]})
+	}
+
+	return deps
+}
+
+// OutputRefs collects the output keys read from each component in v, through
+// (state "stack" "component").key, index (state …) "key" and output
+func OutputRefs(stack string, v any) map[Dependency][]string {
+	jb, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	refs := map[Dependency][]string{}
+	add := func(d Dependency, key string) {
+		if !slices.Contains(refs[d], key) {
+			refs[d] = append(refs[d], key)
+		}
+	}
+	for _, re := range []*regexp.Regexp{stateAttrRe, stateIndexRe} {
+		for _, m := range re.FindAllStringSubmatch(string(jb), -1) {
+			add(Dependency{Stack: m[1], Component: m[2]}, m[3])
+		}
+	}
+	for _, m := range outputCallRe.FindAllStringSubmatch(string(jb), -1) {
+		add(Dependency{Stack: stack, Component: m[1]}, m[2])
+	}
+
+	return refs
 }
 
-// resolve templates in component
-func (c *Component) ResolveVars(config *Config, stacks *Stacks, executor Executor) error {
+// resolve templates in component, op is the running operation which decides
+// whether mock outputs may be used
+func (c *Component) ResolveVars(config *Config, stacks *Stacks, executor Executor, op string) error {
 	tdata := map[string]interface{}{
-		"component": c.Name,
+		"component":      c.Name,
+		"component_path": c.Path,
+		"backend_type":   c.Backend.Type,
 	}
 
 	t, err := NewTemplater(config, stacks, executor, c.Stack)
 	if err != nil {
 		return err
 	}
+	t.op = op
 
 	// template backend
-	c.Backend.Config, err = t.Map(c.Backend.Config, tdata)
+	c.Backend.Config, err = t.Map("backend.config", c.Backend.Config, tdata)
 	if err != nil {
 		return err
 	}
 
 	// template vars
-	c.Inputs, err = t.Map(c.Inputs, tdata)
+	c.Inputs, err = t.Map("inputs", c.Inputs, tdata)
 	if err != nil {
 		return err
 	}
 
-	// template providers
-	c.Providers, err = t.Map(c.Providers, tdata)
+	// template generated files
+	for name, g := range c.Generate {
+		g.Path, err = t.text("generate."+name+".path", g.Path)
+		if err != nil {
+			return err
+		}
+		g.Contents, err = t.text("generate."+name+".contents", g.Contents)
+		if err != nil {
+			return err
+		}
+	}
+
+	// template providers, outputs that don't resolve are read from remote state
+	t.remoteKeys = OutputRefs(c.Stack, c.Providers)
+	c.Providers, err = t.Map("providers", c.Providers, tdata)
 	if err != nil {
 		return err
 	}
+	t.remoteKeys = nil
+
+	c.Mocked = t.mocked
 
-	// Capture failed dependencies from the templater
-	if len(t.failedDeps) > 0 {
-		c.ProviderDependencies = make(map[string]string)
-		for comp, stack := range t.failedDeps {
-			c.ProviderDependencies[comp] = stack
+	for _, rs := range t.remoteStates {
+		rs.Backend, err = remoteBackend(config, stacks, executor, rs)
+		if err != nil {
+			return err
 		}
 	}
+	if len(t.remoteStates) > 0 {
+		c.RemoteStates = t.remoteStates
+	}
 
 	return nil
 }
+
+// remoteBackend resolves the backend of the component read by a remote state
+// data source, templated for that component
+func remoteBackend(config *Config, stacks *Stacks, executor Executor, rs *RemoteState) (Backend, error) {
+	stack, err := stacks.GetStack(rs.Stack)
+	if err != nil {
+		return Backend{}, err
+	}
+
+	ref, err := stack.GetComponent(rs.Component)
+	if err != nil {
+		return Backend{}, err
+	}
+
+	t, err := NewTemplater(config, stacks, executor, ref.Stack)
+	if err != nil {
+		return Backend{}, err
+	}
+
+	bc, err := t.Map("backend.config", ref.Backend.Config, map[string]interface{}{"component": ref.Name})
+	if err != nil {
+		return Backend{}, err
+	}
+
+	return Backend{Type: ref.Backend.Type, Config: bc}, nil
+}
@@ -7,6 +7,8 @@ type Config struct {
 	WorkDir         string            `mapstructure:"work_dir"`
 	GenerateBackend bool              `mapstructure:"generate_backend"`
 	Env             map[string]string `mapstructure:"env"`
+	VarsFiles       []string          `mapstructure:"vars_files"`       // layered into stack options, e.g. vars/{{ .stack }}.yaml
+	StrictTemplates bool              `mapstructure:"strict_templates"` // fail on missing values instead of rendering <no value>, on in CI
 	Bootstrap       []*BootstrapStep  `mapstructure:"bootstrap"`
 }
 
@@ -0,0 +1,141 @@
+package schema
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/moonwalker/comet/internal/version"
+)
+
+const (
+	// cometDir holds the caches, index and work dirs comet writes next to
+	// the stacks, it doesn't make the checkout dirty
+	cometDir = ".comet"
+)
+
+var (
+	gitCache   = map[string]map[string]interface{}{}
+	gitCacheMu sync.Mutex
+)
+
+// templateContext describes the stack, who runs comet and from which commit,
+// stack options with the same names take precedence
+func templateContext(stacksDir string, stack *Stack) map[string]interface{} {
+	return map[string]interface{}{
+		"metadata":      metadataContext(stack.Metadata),
+		"backend_type":  stack.Backend.Type,
+		"comet_version": version.Version(),
+		"user":          currentUser(),
+		"git":           gitContext(stacksDir),
+	}
+}
+
+// metadataContext exposes the stack metadata with custom as a map, it is
+// kept as ordered key value pairs for display
+func metadataContext(md *Metadata) map[string]interface{} {
+	res := map[string]interface{}{
+		"description": "",
+		"owner":       "",
+		"tags":        []string{},
+		"custom":      map[string]interface{}{},
+	}
+	if md == nil {
+		return res
+	}
+
+	res["description"] = md.Description
+	res["owner"] = md.Owner
+	if md.Tags != nil {
+		res["tags"] = md.Tags
+	}
+
+	custom := res["custom"].(map[string]interface{})
+	switch c := md.Custom.(type) {
+	case []interface{}:
+		for i := 0; i+1 < len(c); i += 2 {
+			if k, ok := c[i].(string); ok {
+				custom[k] = c[i+1]
+			}
+		}
+	case map[string]interface{}:
+		for k, v := range c {
+			custom[k] = v
+		}
+	}
+
+	return res
+}
+
+func currentUser() string {
+	u, err := user.Current()
+	if err == nil && len(u.Username) > 0 {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// gitContext describes the commit the stacks are deployed from, values are
+// empty outside of a git repository, the branch is empty on a detached HEAD
+func gitContext(dir string) map[string]interface{} {
+	gitCacheMu.Lock()
+	defer gitCacheMu.Unlock()
+
+	if res, ok := gitCache[dir]; ok {
+		return res
+	}
+
+	res := map[string]interface{}{"sha": "", "branch": "", "dirty": false}
+	gitCache[dir] = res
+
+	sha, err := git(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return res
+	}
+	res["sha"] = sha
+
+	branch, _ := git(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if branch != "HEAD" {
+		res["branch"] = branch
+	}
+
+	status, err := git(dir, "status", "--porcelain", "--", excludeCometDir(dir))
+	if err != nil {
+		// .comet is outside of the repository
+		status, _ = git(dir, "status", "--porcelain")
+	}
+	res["dirty"] = len(status) > 0
+
+	return res
+}
+
+// excludeCometDir returns a pathspec excluding the .comet directory of the
+// working directory, relative to dir where git runs
+func excludeCometDir(dir string) string {
+	path := cometDir
+	abs, err := filepath.Abs(cometDir)
+	if err == nil {
+		absDir, err := filepath.Abs(dir)
+		if err == nil {
+			if rel, err := filepath.Rel(absDir, abs); err == nil {
+				path = rel
+			}
+		}
+	}
+	return ":(exclude)" + filepath.ToSlash(path)
+}
+
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,111 @@
+package schema
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplateContext(t *testing.T) {
+	dir := t.TempDir()
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	run("init", "-q", "-b", "main")
+	os.WriteFile(filepath.Join(dir, "dev.stack.js"), []byte("stack('dev', {})\n"), 0644)
+	run("add", "-A")
+	run("commit", "-q", "-m", "init")
+	sha := run("rev-parse", "HEAD")
+	os.WriteFile(filepath.Join(dir, "dev.stack.js"), []byte("stack('dev', { a: 1 })\n"), 0644)
+
+	stack := NewStack(filepath.Join(dir, "dev.stack.js"), "js")
+	stack.Name = "dev"
+	stack.Options = map[string]interface{}{"user": "deployer"}
+	stack.Metadata = &Metadata{Owner: "platform", Tags: []string{"core"}, Custom: []interface{}{"team", "infra", "tier", int64(1)}}
+	stack.Backend = Backend{Type: "gcs", Config: map[string]interface{}{}}
+	vpc := stack.AddComponent("vpc", filepath.Join(dir, "modules/vpc"), map[string]interface{}{
+		"labels": map[string]interface{}{
+			"commit": "{{ .git.sha }}",
+			"branch": "{{ .git.branch }}",
+			"dirty":  "{{ .git.dirty }}",
+			"owner":  "{{ .metadata.owner }}",
+			"team":   "{{ .metadata.custom.team }}",
+			"tag":    "{{ index .metadata.tags 0 }}",
+			"path":   "{{ .component_path }}",
+			"engine": "{{ .backend_type }}-{{ .comet_version }}",
+			"by":     "{{ .user }}",
+		},
+	}, nil)
+
+	stacks := &Stacks{}
+	stacks.AddStack(stack)
+
+	err := vpc.ResolveVars(&Config{StacksDir: dir}, stacks, nil, "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels := vpc.Inputs["labels"].(map[string]interface{})
+	want := map[string]interface{}{
+		"commit": sha,
+		"branch": "main",
+		"dirty":  true,
+		"owner":  "platform",
+		"team":   "infra",
+		"tag":    "core",
+		"path":   filepath.Join(dir, "modules/vpc"),
+		"engine": "gcs-dev",
+		"by":     "deployer", // stack options win over the context
+	}
+	for k, v := range want {
+		if labels[k] != v {
+			t.Errorf("%s = %v, want %v", k, labels[k], v)
+		}
+	}
+}
+
+func TestGitContextIgnoresCometDir(t *testing.T) {
+	dir := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	run("init", "-q", "-b", "main")
+	os.MkdirAll(filepath.Join(dir, "stacks"), 0755)
+	os.WriteFile(filepath.Join(dir, "stacks", "dev.stack.js"), []byte("stack('dev', {})\n"), 0644)
+	run("add", "-A")
+	run("commit", "-q", "-m", "init")
+
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	// written by the stack loader before templates run
+	os.MkdirAll(filepath.Join(".comet", "cache"), 0755)
+	os.WriteFile(filepath.Join(".comet", "stacks.json"), []byte("{}"), 0644)
+
+	if res := gitContext("stacks"); res["dirty"] != false || res["sha"] == "" {
+		t.Errorf("git context = %v, want a clean checkout", res)
+	}
+}
@@ -1,9 +1,16 @@
 package schema
 
+import (
+	"github.com/hashicorp/go-version"
+)
+
 type Executor interface {
 	Init(component *Component) error
 	Plan(component *Component) (bool, error)
+	Changes(component *Component) ([]*ResourceChange, error) // resource changes of the last plan
 	Apply(component *Component) error
+	ApplyPlan(component *Component) error // apply the last plan unchanged
 	Destroy(component *Component) error
 	Output(component *Component) (map[string]*OutputMeta, error)
+	Version() (*version.Version, error) // version of the tf command
 }
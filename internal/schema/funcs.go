@@ -0,0 +1,142 @@
+package schema
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/moonwalker/comet/internal/secrets"
+)
+
+// templateFuncs are the functions available to templates in inputs,
+// providers and backend configs, state and output are added per stack
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"split":    splitFunc,
+		"join":     joinFunc,
+		"replace":  replaceFunc,
+		"lower":    strings.ToLower,
+		"upper":    strings.ToUpper,
+		"trim":     strings.TrimSpace,
+		"default":  defaultFunc,
+		"required": requiredFunc,
+		"coalesce": coalesceFunc,
+		"toJson":   toJSONFunc,
+		"fromJson": fromJSONFunc,
+		"b64enc":   b64encFunc,
+		"b64dec":   b64decFunc,
+		"sha256":   sha256Func,
+		"env":      os.Getenv,
+		"secret":   secrets.Get,
+	}
+}
+
+// split "/" "a/b" -> [a b], the string comes last so it can be piped
+func splitFunc(sep string, s string) []string {
+	return strings.Split(s, sep)
+}
+
+// join "," list, accepts any list since outputs decode to []interface{}
+func joinFunc(sep string, list any) string {
+	switch v := list.(type) {
+	case []string:
+		return strings.Join(v, sep)
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprintf("%v", item)
+		}
+		return strings.Join(items, sep)
+	}
+	return fmt.Sprintf("%v", list)
+}
+
+// replace "old" "new" s
+func replaceFunc(old, new string, s string) string {
+	return strings.ReplaceAll(s, old, new)
+}
+
+// default "us-east1" .region, the value is variadic so a missing one can be piped
+func defaultFunc(def any, v ...any) any {
+	if len(v) == 0 || empty(v[0]) {
+		return def
+	}
+	return v[0]
+}
+
+// required "region is not set" .region
+func requiredFunc(msg string, v any) (any, error) {
+	if empty(v) {
+		return nil, errors.New(msg)
+	}
+	return v, nil
+}
+
+// coalesce returns the first non-empty value
+func coalesceFunc(v ...any) any {
+	for _, e := range v {
+		if !empty(e) {
+			return e
+		}
+	}
+	return nil
+}
+
+func toJSONFunc(v any) (string, error) {
+	jb, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(jb), nil
+}
+
+func fromJSONFunc(s string) (any, error) {
+	var v any
+	err := json.Unmarshal([]byte(s), &v)
+	if err != nil {
+		return nil, fmt.Errorf("fromJson: %w", err)
+	}
+	return v, nil
+}
+
+func b64encFunc(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func b64decFunc(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("b64dec: %w", err)
+	}
+	return string(b), nil
+}
+
+// sha256 returns the hex encoded digest of s
+func sha256Func(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// empty reports whether v is nil or the zero value of its type, empty
+// strings, lists and maps included
+func empty(v any) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	}
+	return rv.IsZero()
+}
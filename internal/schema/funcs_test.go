@@ -0,0 +1,96 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// outputsExecutor returns fixed outputs per component
+type outputsExecutor struct {
+	Executor
+	outputs map[string]map[string]any
+}
+
+func (e *outputsExecutor) Output(c *Component) (map[string]*OutputMeta, error) {
+	outputs, ok := e.outputs[c.Name]
+	if !ok {
+		return nil, errors.New("no state")
+	}
+
+	res := map[string]*OutputMeta{}
+	for k, v := range outputs {
+		jb, _ := json.Marshal(v)
+		res[k] = &OutputMeta{Value: jb}
+	}
+	return res, nil
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	t.Setenv("COMET_TEST_REGION", "eu-west-1")
+
+	stack := NewStack("dev.stack.js", "js")
+	stack.Name = "dev"
+	stack.Options = map[string]interface{}{"name": "app", "empty": ""}
+	stack.AddComponent("vpc", t.TempDir(), map[string]interface{}{}, nil)
+
+	stacks := &Stacks{}
+	stacks.AddStack(stack)
+
+	executor := &outputsExecutor{outputs: map[string]map[string]any{
+		"vpc": {"id": "vpc-123", "zones": []string{"a", "b"}},
+	}}
+
+	tmpl, err := NewTemplater(&Config{StacksDir: t.TempDir()}, stacks, executor, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		`{{ .missing | default "fallback" }}`:     "fallback",
+		`{{ .empty | default "fallback" }}`:       "fallback",
+		`{{ .name | default "fallback" }}`:        "app",
+		`{{ required "name is required" .name }}`: "app",
+		`{{ coalesce .empty .missing .name }}`:    "app",
+		`{{ .name | upper }}-{{ "A/B" | lower }}`: "APP-a/b",
+		`{{ "a.b" | replace "." "-" }}`:           "a-b",
+		`{{ "a,b" | split "," | join "/" }}`:      "a/b",
+		`{{ (fromJson "[1,2]") | join "+" }}`:     "1+2",
+		`{{ "secret" | b64enc }}`:                 "c2VjcmV0",
+		`{{ "c2VjcmV0" | b64dec }}`:               "secret",
+		`{{ "comet" | sha256 }}`:                  "d51f791051c2e5f9112c57109acd4d7b9b5788df79db36fa24c09c3c9ee8a569",
+		`{{ env "COMET_TEST_REGION" }}`:           "eu-west-1",
+		`{{ output "vpc" "id" }}`:                 "vpc-123",
+		`{{ output "vpc" "zones" | join "," }}`:   "a,b",
+		`{{ (state "dev" "vpc").id | toJson }}`:   `"vpc-123"`,
+	}
+
+	for src, want := range tests {
+		res, err := tmpl.Map("inputs", map[string]interface{}{"v": src}, nil)
+		if err != nil {
+			t.Errorf("%s: error = %v", src, err)
+			continue
+		}
+		if res["v"] != want {
+			t.Errorf("%s = %v, want %s", src, res["v"], want)
+		}
+	}
+
+	_, err = tmpl.Map("inputs", map[string]interface{}{"v": `{{ required "region is required" .region }}`}, nil)
+	if err == nil || !strings.Contains(err.Error(), "region is required") {
+		t.Errorf("required error = %v", err)
+	}
+}
+
+func TestFindDependenciesOutput(t *testing.T) {
+	deps := FindDependencies("dev", map[string]interface{}{
+		"a": `{{ output "vpc" "id" }}`,
+		"b": `{{ (state "shared" "dns").zone }}`,
+	})
+
+	want := []Dependency{{Stack: "shared", Component: "dns"}, {Stack: "dev", Component: "vpc"}}
+	if len(deps) != 2 || deps[0] != want[0] || deps[1] != want[1] {
+		t.Errorf("FindDependencies() = %v, want %v", deps, want)
+	}
+}
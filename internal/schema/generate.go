@@ -0,0 +1,121 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	errGenerate         = "generate %s: %w"
+	errGenerates        = "generate must be an object of files by name"
+	errGeneratePath     = "generate %s: path is required"
+	errGenerateOutside  = "generate %s: path %s is outside of the component directory"
+	errGenerateIfExists = "generate %s: if_exists must be one of %s"
+
+	IfExistsOverwrite = "overwrite"
+	IfExistsSkip      = "skip"
+	IfExistsError     = "error"
+)
+
+var (
+	ifExists = []string{IfExistsOverwrite, IfExistsSkip, IfExistsError}
+)
+
+// Generate is a file written into the component directory before init, like
+// the generate blocks of terragrunt
+type Generate struct {
+	Path     string `json:"path"`                // relative to the component directory
+	Contents string `json:"contents"`            // templated like inputs
+	IfExists string `json:"if_exists,omitempty"` // error (default) or skip when a file not generated by comet exists, overwrite only replaces generated files
+}
+
+// ParseGenerate converts the options of generate(name, {...}) in a stack file
+func ParseGenerate(name string, v any) (*Generate, error) {
+	jb, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf(errGenerate, name, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(jb))
+	dec.DisallowUnknownFields()
+
+	g := &Generate{}
+	err = dec.Decode(g)
+	if err != nil {
+		return nil, fmt.Errorf(errGenerate, name, err)
+	}
+
+	if len(g.Path) == 0 {
+		return nil, fmt.Errorf(errGeneratePath, name)
+	}
+	if len(g.IfExists) == 0 {
+		g.IfExists = IfExistsError
+	}
+	if !slices.Contains(ifExists, g.IfExists) {
+		return nil, fmt.Errorf(errGenerateIfExists, name, strings.Join(ifExists, ", "))
+	}
+
+	return g, nil
+}
+
+// ParseGenerates converts the generate option of a component, a map of
+// generate options by name
+func ParseGenerates(v any) (map[string]*Generate, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New(errGenerates)
+	}
+
+	res := make(map[string]*Generate, len(m))
+	for name, gv := range m {
+		g, err := ParseGenerate(name, gv)
+		if err != nil {
+			return nil, err
+		}
+		res[name] = g
+	}
+
+	return res, nil
+}
+
+// Target returns the file to write in dir, which must not leave dir
+func (g *Generate) Target(name, dir string) (string, error) {
+	if filepath.IsAbs(g.Path) {
+		return "", fmt.Errorf(errGenerateOutside, name, g.Path)
+	}
+
+	target := filepath.Join(dir, g.Path)
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf(errGenerateOutside, name, g.Path)
+	}
+
+	return target, nil
+}
+
+// Generates returns the files the stack generates into c, files of the
+// component replace stack files with the same name
+func (s *Stack) Generates(c *Component) map[string]*Generate {
+	if len(s.Generate) == 0 {
+		return c.Generate
+	}
+
+	res := make(map[string]*Generate, len(s.Generate)+len(c.Generate))
+	for name, g := range s.Generate {
+		gc := *g
+		res[name] = &gc
+	}
+	for name, g := range c.Generate {
+		res[name] = g
+	}
+	return res
+}
@@ -0,0 +1,66 @@
+package schema
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseGenerateErrors(t *testing.T) {
+	tests := map[string]any{
+		"unknown field": map[string]interface{}{"path": "a.tf", "content": "x"},
+		"no path":       map[string]interface{}{"contents": "x"},
+		"if_exists":     map[string]interface{}{"path": "a.tf", "if_exists": "append"},
+	}
+
+	for name, v := range tests {
+		_, err := ParseGenerate("backend", v)
+		if err == nil || !strings.HasPrefix(err.Error(), "generate backend:") {
+			t.Errorf("%s: error = %v", name, err)
+		}
+	}
+
+	g, err := ParseGenerate("backend", map[string]interface{}{"path": "backend.tf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.IfExists != IfExistsError {
+		t.Errorf("IfExists = %q, want %q", g.IfExists, IfExistsError)
+	}
+}
+
+func TestGenerateTarget(t *testing.T) {
+	dir := t.TempDir()
+
+	got, err := (&Generate{Path: "conf/app.json"}).Target("app", dir)
+	if err != nil || got != filepath.Join(dir, "conf", "app.json") {
+		t.Errorf("Target() = %s, %v", got, err)
+	}
+
+	for _, p := range []string{"../app.json", "conf/../../app.json", "/etc/app.json"} {
+		_, err := (&Generate{Path: p}).Target("app", dir)
+		if err == nil || !strings.Contains(err.Error(), "outside of the component directory") {
+			t.Errorf("%s: error = %v", p, err)
+		}
+	}
+}
+
+func TestStackGenerates(t *testing.T) {
+	stack := &Stack{Generate: map[string]*Generate{
+		"backend": {Path: "backend.tf", Contents: "stack"},
+		"locals":  {Path: "locals.tf", Contents: "stack"},
+	}}
+	c := &Component{Generate: map[string]*Generate{
+		"backend": {Path: "backend.tf", Contents: "component"},
+	}}
+
+	got := stack.Generates(c)
+	if len(got) != 2 || got["backend"].Contents != "component" || got["locals"].Contents != "stack" {
+		t.Errorf("Generates() = %v", got)
+	}
+
+	got["locals"].Contents = "changed"
+	if stack.Generate["locals"].Contents != "stack" {
+		t.Error("Generates() shares the stack files")
+	}
+}
@@ -0,0 +1,124 @@
+package schema
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/moonwalker/comet/internal/log"
+)
+
+const (
+	HookBeforePlan    = "before_plan"
+	HookAfterPlan     = "after_plan"
+	HookBeforeApply   = "before_apply"
+	HookAfterApply    = "after_apply"
+	HookBeforeDestroy = "before_destroy"
+	HookAfterDestroy  = "after_destroy"
+	HookOnError       = "on_error"
+)
+
+var (
+	HookEvents = []string{
+		HookBeforePlan, HookAfterPlan,
+		HookBeforeApply, HookAfterApply,
+		HookBeforeDestroy, HookAfterDestroy,
+		HookOnError,
+	}
+
+	envNameRe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+)
+
+type (
+	// Hooks maps a lifecycle event to the hooks run on it, in order
+	Hooks map[string][]*Hook
+
+	// Hook is either a shell command or a callback from the stack file
+	Hook struct {
+		Command  string   `json:"command,omitempty"`
+		Func     HookFunc `json:"-"`
+		Optional bool     `json:"optional,omitempty"` // failures are logged instead of aborting the run
+	}
+
+	HookFunc func(ctx *HookContext) error
+
+	// HookContext describes what a hook runs for, exposed to commands as
+	// COMET_* env vars and to callbacks as an object
+	HookContext struct {
+		Event     string            `json:"event"`
+		Operation string            `json:"operation"`
+		Stack     string            `json:"stack"`
+		Component string            `json:"component,omitempty"`
+		Path      string            `json:"path,omitempty"`
+		Outputs   map[string]string `json:"outputs,omitempty"`
+		Error     string            `json:"error,omitempty"`
+	}
+)
+
+// ValidHookEvent reports whether hooks can be declared for event
+func ValidHookEvent(event string) bool {
+	return slices.Contains(HookEvents, event)
+}
+
+// Has reports whether any hook is declared for event
+func (h Hooks) Has(event string) bool {
+	return len(h[event]) > 0
+}
+
+// Run runs the hooks declared for an event, stopping at the first failing
+// hook that is not optional
+func (h Hooks) Run(ctx *HookContext) error {
+	for _, hook := range h[ctx.Event] {
+		err := hook.Run(ctx)
+		if err == nil {
+			continue
+		}
+		if hook.Optional {
+			log.Warn("optional hook failed", "event", ctx.Event, "stack", ctx.Stack, "component", ctx.Component, "error", err)
+			continue
+		}
+		return fmt.Errorf("%s hook failed: %w", ctx.Event, err)
+	}
+	return nil
+}
+
+func (h *Hook) Run(ctx *HookContext) error {
+	if h.Func != nil {
+		log.Debug("run hook callback", "event", ctx.Event, "stack", ctx.Stack, "component", ctx.Component)
+		return h.Func(ctx)
+	}
+
+	log.Info(fmt.Sprintf("⏳ %s: %s", ctx.Event, h.Command))
+
+	cmd := exec.Command("sh", "-c", h.Command)
+	cmd.Env = append(os.Environ(), ctx.Env()...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// Env returns the context as environment variables, outputs are available
+// as COMET_OUTPUT_<NAME>
+func (ctx *HookContext) Env() []string {
+	env := []string{
+		"COMET_EVENT=" + ctx.Event,
+		"COMET_OPERATION=" + ctx.Operation,
+		"COMET_STACK=" + ctx.Stack,
+	}
+	if len(ctx.Component) > 0 {
+		env = append(env, "COMET_COMPONENT="+ctx.Component, "COMET_COMPONENT_PATH="+ctx.Path)
+	}
+	if len(ctx.Error) > 0 {
+		env = append(env, "COMET_ERROR="+ctx.Error)
+	}
+	for k, v := range ctx.Outputs {
+		name := strings.ToUpper(envNameRe.ReplaceAllString(k, "_"))
+		env = append(env, "COMET_OUTPUT_"+name+"="+v)
+	}
+	return env
+}
@@ -0,0 +1,65 @@
+package schema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHooksRun(t *testing.T) {
+	var calls []string
+	record := func(name string, err error) *Hook {
+		return &Hook{Func: func(ctx *HookContext) error {
+			calls = append(calls, name)
+			return err
+		}}
+	}
+
+	optional := record("optional", errors.New("flaky"))
+	optional.Optional = true
+
+	hooks := Hooks{
+		HookAfterApply: {
+			{Command: `test "$COMET_OUTPUT_CLUSTER_ENDPOINT" = "https://gke" && test "$COMET_COMPONENT" = gke`},
+			optional,
+			record("second", nil),
+		},
+		HookBeforeDestroy: {
+			record("fails", errors.New("boom")),
+			record("skipped", nil),
+		},
+	}
+
+	ctx := &HookContext{
+		Event:     HookAfterApply,
+		Operation: "apply",
+		Stack:     "dev",
+		Component: "gke",
+		Outputs:   map[string]string{"cluster-endpoint": "https://gke"},
+	}
+	if err := hooks.Run(ctx); err != nil {
+		t.Fatalf("Run(after_apply) error = %v", err)
+	}
+
+	ctx.Event = HookBeforeDestroy
+	err := hooks.Run(ctx)
+	if err == nil || !strings.Contains(err.Error(), "before_destroy hook failed: boom") {
+		t.Errorf("Run(before_destroy) error = %v", err)
+	}
+
+	if got := strings.Join(calls, ","); got != "optional,second,fails" {
+		t.Errorf("calls = %s", got)
+	}
+
+	ctx.Event = HookAfterApply
+	ctx.Outputs["cluster-endpoint"] = "other"
+	if err := hooks.Run(ctx); err == nil {
+		t.Error("Run() with failing command error = nil")
+	}
+
+	// events without hooks are a no-op
+	ctx.Event = HookBeforePlan
+	if err := (Hooks(nil)).Run(ctx); err != nil {
+		t.Errorf("Run() on nil hooks error = %v", err)
+	}
+}
@@ -80,6 +80,8 @@ func (k *Kubeconfig) Write(out io.Writer, config *Config, stacks *Stacks, execut
 	if err != nil {
 		return err
 	}
+	// clusters are written before they are applied too
+	t.strict = false
 
 	err = t.Any(k, nil)
 	if err != nil {
@@ -0,0 +1,27 @@
+package schema
+
+import (
+	"slices"
+)
+
+// ResourceChange is a resource the plan of a component would change
+type ResourceChange struct {
+	Address string   `json:"address"`
+	Actions []string `json:"actions"` // create, read, update, delete or no-op, replace is delete and create
+}
+
+// Destructive reports whether the change deletes or replaces the resource
+func (r *ResourceChange) Destructive() bool {
+	return slices.Contains(r.Actions, "delete")
+}
+
+// Destructive returns the changes that delete or replace a resource
+func Destructive(changes []*ResourceChange) []*ResourceChange {
+	var res []*ResourceChange
+	for _, c := range changes {
+		if c.Destructive() {
+			res = append(res, c)
+		}
+	}
+	return res
+}
@@ -0,0 +1,26 @@
+package schema
+
+import (
+	"testing"
+)
+
+func TestDestructive(t *testing.T) {
+	changes := []*ResourceChange{
+		{Address: "google_sql_database_instance.db", Actions: []string{"update"}},
+		{Address: "google_sql_database.app", Actions: []string{"delete", "create"}},
+		{Address: "google_sql_user.app", Actions: []string{"create", "delete"}},
+		{Address: "random_password.app", Actions: []string{"delete"}},
+		{Address: "google_sql_user.ro", Actions: []string{"create"}},
+		{Address: "data.google_project.p", Actions: []string{"read"}},
+	}
+
+	got := Destructive(changes)
+	if len(got) != 3 {
+		t.Fatalf("Destructive() = %d changes, want 3", len(got))
+	}
+	for i, want := range []string{"google_sql_database.app", "google_sql_user.app", "random_password.app"} {
+		if got[i].Address != want {
+			t.Errorf("Destructive()[%d] = %s, want %s", i, got[i].Address, want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	errSelector = "invalid label selector %q: %s"
+)
+
+var (
+	labelKeyRe = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_.\-/]*[A-Za-z0-9])?$`)
+	setExprRe  = regexp.MustCompile(`^(\S+)\s+(in|notin)\s+\(([^)]*)\)$`)
+)
+
+type (
+	// Selector matches component labels, using the kubectl syntax:
+	// tier=network,team!=data,env in (dev,stg),critical,!legacy
+	Selector []*requirement
+
+	requirement struct {
+		key    string
+		op     string // =, !=, in, notin, exists, !exists
+		values []string
+	}
+)
+
+// ParseSelector parses a comma separated list of label requirements, all of
+// which must match. An empty string selects everything.
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+
+	for _, part := range splitSelector(s) {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+
+		r, err := parseRequirement(part)
+		if err != nil {
+			return nil, fmt.Errorf(errSelector, s, err)
+		}
+		sel = append(sel, r)
+	}
+
+	return sel, nil
+}
+
+func parseRequirement(s string) (*requirement, error) {
+	r := &requirement{}
+
+	switch {
+	case setExprRe.MatchString(s):
+		m := setExprRe.FindStringSubmatch(s)
+		r.key, r.op = m[1], m[2]
+		for _, v := range strings.Split(m[3], ",") {
+			r.values = append(r.values, strings.TrimSpace(v))
+		}
+	case strings.Contains(s, "!="):
+		k, v, _ := strings.Cut(s, "!=")
+		r.key, r.op, r.values = strings.TrimSpace(k), "!=", []string{strings.TrimSpace(v)}
+	case strings.Contains(s, "=="):
+		k, v, _ := strings.Cut(s, "==")
+		r.key, r.op, r.values = strings.TrimSpace(k), "=", []string{strings.TrimSpace(v)}
+	case strings.Contains(s, "="):
+		k, v, _ := strings.Cut(s, "=")
+		r.key, r.op, r.values = strings.TrimSpace(k), "=", []string{strings.TrimSpace(v)}
+	case strings.HasPrefix(s, "!"):
+		r.key, r.op = strings.TrimSpace(s[1:]), "!exists"
+	default:
+		r.key, r.op = s, "exists"
+	}
+
+	if !labelKeyRe.MatchString(r.key) {
+		return nil, fmt.Errorf("invalid label key %q", r.key)
+	}
+
+	return r, nil
+}
+
+// splitSelector splits on commas outside of parentheses
+func splitSelector(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, ch := range s {
+		switch ch {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Matches reports whether labels satisfy all requirements of the selector
+func (sel Selector) Matches(labels map[string]string) bool {
+	for _, r := range sel {
+		if !r.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *requirement) matches(labels map[string]string) bool {
+	v, ok := labels[r.key]
+
+	switch r.op {
+	case "=", "in":
+		return ok && slices.Contains(r.values, v)
+	case "!=", "notin":
+		return !ok || !slices.Contains(r.values, v)
+	case "exists":
+		return ok
+	case "!exists":
+		return !ok
+	}
+
+	return false
+}
+
+// Select returns the components matching the selector, keeping their order
+func (sel Selector) Select(components []*Component) []*Component {
+	if len(sel) == 0 {
+		return components
+	}
+
+	res := make([]*Component, 0, len(components))
+	for _, c := range components {
+		if sel.Matches(c.Labels) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
@@ -0,0 +1,60 @@
+package schema
+
+import (
+	"testing"
+)
+
+func TestSelector(t *testing.T) {
+	labels := map[string]string{"tier": "network", "team": "data", "env": "dev"}
+
+	tests := []struct {
+		sel  string
+		want bool
+	}{
+		{"", true},
+		{"tier=network", true},
+		{"tier==network", true},
+		{"tier=network,team!=data", false},
+		{"tier=network, team!=infra", true},
+		{"missing!=x", true},
+		{"missing=x", false},
+		{"env in (dev,stg)", true},
+		{"env notin (dev, stg),tier=network", false},
+		{"env in (prd),tier", false},
+		{"team", true},
+		{"!legacy", true},
+		{"!team", false},
+	}
+
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.sel)
+		if err != nil {
+			t.Errorf("ParseSelector(%q) error = %v", tt.sel, err)
+			continue
+		}
+		if got := sel.Matches(labels); got != tt.want {
+			t.Errorf("ParseSelector(%q).Matches() = %v, want %v", tt.sel, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{"=x", "tier in dev", "a b=c"} {
+		if _, err := ParseSelector(s); err == nil {
+			t.Errorf("ParseSelector(%q) error = nil", s)
+		}
+	}
+}
+
+func TestSelectorSelect(t *testing.T) {
+	components := []*Component{
+		{Name: "vpc", Labels: map[string]string{"tier": "network"}},
+		{Name: "db", Labels: map[string]string{"tier": "data"}},
+		{Name: "dns", Labels: map[string]string{"tier": "network"}},
+		{Name: "app"},
+	}
+
+	sel, _ := ParseSelector("tier=network")
+	got := sel.Select(components)
+	if len(got) != 2 || got[0].Name != "vpc" || got[1].Name != "dns" {
+		t.Errorf("Select() = %v", got)
+	}
+}
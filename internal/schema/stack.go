@@ -1,8 +1,10 @@
 package schema
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
 	"slices"
 	"strings"
 )
@@ -14,18 +16,25 @@ const (
 	errComponentsNotFound = "no components found in stack: %s"
 )
 
+var (
+	stateRefRe = regexp.MustCompile(`state\s+\\?"([^"\\]+)\\?"`)
+)
+
 type (
 	Stack struct {
-		Path       string              `json:"path"`
-		Type       string              `json:"type"`
-		Name       string              `json:"name"`
-		Options    any                 `json:"options"`
-		Metadata   *Metadata           `json:"metadata,omitempty"`
-		Backend    Backend             `json:"backend"`
-		Appends    map[string][]string `json:"appends"`
-		Components []*Component        `json:"components"`
-		Kubeconfig *Kubeconfig         `json:"kubeconfig"`
-		Envs       map[string]string   `json:"envs,omitempty"` // Environment variables to set for this stack
+		Path       string               `json:"path"`
+		Type       string               `json:"type"`
+		Name       string               `json:"name"`
+		Options    any                  `json:"options"`
+		Metadata   *Metadata            `json:"metadata,omitempty"`
+		Backend    Backend              `json:"backend"`
+		Appends    map[string][]string  `json:"appends"`
+		Components []*Component         `json:"components"`
+		Kubeconfig *Kubeconfig          `json:"kubeconfig"`
+		Envs       map[string]string    `json:"envs,omitempty"` // Environment variables to set for this stack
+		Hooks      Hooks                `json:"hooks,omitempty"`
+		Versions   *Versions            `json:"versions,omitempty"` // tofu and provider versions of all components
+		Generate   map[string]*Generate `json:"generate,omitempty"` // files written into all components, by name
 	}
 
 	Metadata struct {
@@ -33,6 +42,7 @@ type (
 		Owner       string   `json:"owner,omitempty"`
 		Tags        []string `json:"tags,omitempty"`
 		Custom      any      `json:"custom,omitempty"`
+		Protected   bool     `json:"protected,omitempty"` // protects all components of the stack
 	}
 
 	Stacks struct {
@@ -63,6 +73,7 @@ func (s *Stack) AddComponent(name, path string, inputs map[string]interface{}, p
 		Path:      path,
 		Inputs:    inputs,
 		Providers: providers,
+		Depends:   FindDependencies(s.Name, inputs, providers),
 	}
 	s.Components = append(s.Components, c)
 	return c
@@ -101,6 +112,30 @@ func (s *Stack) GetComponents(filterNames []string) ([]*Component, error) {
 	return result, nil
 }
 
+// Protects reports whether a component of the stack is protected from
+// destruction, either itself or through the stack metadata
+func (s *Stack) Protects(c *Component) bool {
+	return c.Protect || (s.Metadata != nil && s.Metadata.Protected)
+}
+
+// References returns the names of other stacks this stack reads outputs from
+// through the state template function
+func (s *Stack) References() []string {
+	jb, err := json.Marshal([]any{s.Backend, s.Components, s.Kubeconfig})
+	if err != nil {
+		return nil
+	}
+
+	refs := []string{}
+	for _, m := range stateRefRe.FindAllStringSubmatch(string(jb), -1) {
+		if m[1] != s.Name && !slices.Contains(refs, m[1]) {
+			refs = append(refs, m[1])
+		}
+	}
+
+	return refs
+}
+
 // ApplyEnvs sets the environment variables defined in this stack.
 // Returns a cleanup function to restore the previous values.
 func (s *Stack) ApplyEnvs() func() {
@@ -5,16 +5,45 @@ import (
 	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
+	"text/template/parse"
 
 	"dario.cat/mergo"
+
+	"github.com/moonwalker/comet/internal/log"
+)
+
+const (
+	errNoState   = "state %s %s: the component does not exist or has no outputs"
+	errNoOutput  = "output %s %s: the component has no such output"
+	errMockApply = "state %s %s: the component has no outputs, refusing to apply with its mock outputs"
+	errMockOp    = "mock_outputs_allowed: %s is not one of %s"
+)
+
+var (
+	// operations that can use mock outputs, apply never does
+	mockOps        = []string{"plan", "validate", "init", "output", "export", "destroy"}
+	defaultMockOps = []string{"plan"}
+
+	jsonKeyRe  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+	hclIdentRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	hclNameRe  = regexp.MustCompile(`[^A-Za-z0-9_-]`)
 )
 
 type Templater struct {
-	data       map[string]interface{}
-	funcMap    template.FuncMap
-	failedDeps map[string]string // track failed component dependencies: component -> stack
+	data         map[string]interface{}
+	funcMap      template.FuncMap
+	strict       bool                    // fail on missing keys and state that doesn't resolve
+	op           string                  // running operation, mock outputs are only used by operations that allow them
+	mocking      bool                    // the value being templated read mock outputs
+	mocked       []string                // paths of the values that read mock outputs
+	remoteKeys   map[Dependency][]string // outputs that are read from remote state when they don't resolve
+	remoteStates map[string]*RemoteState // remote state data sources standing in for unresolved outputs
 }
 
 func NewTemplater(config *Config, stacks *Stacks, executor Executor, stackName string) (*Templater, error) {
@@ -33,29 +62,47 @@ func NewTemplater(config *Config, stacks *Stacks, executor Executor, stackName s
 		"stack":      stack.Name,
 	}
 
-	err = mergo.Merge(&data, stack.Options)
+	// stack options override the values from vars files
+	vars, err := LoadVarsFiles(config.VarsFiles, stack.Name)
+	if err != nil {
+		return nil, err
+	}
+	options, _ := stack.Options.(map[string]interface{})
+	vars = MergeVars(vars, options)
+
+	err = mergo.Merge(&data, vars)
 	if err != nil {
 		return nil, err
 	}
 
+	for k, v := range templateContext(stacksDirAbs, stack) {
+		if _, ok := data[k]; !ok {
+			data[k] = v
+		}
+	}
+
 	templater := &Templater{
-		data:       data,
-		failedDeps: make(map[string]string),
-		funcMap: template.FuncMap{
-			"state": stateFunc(config, stacks, executor),
-		},
+		data:         data,
+		funcMap:      templateFuncs(),
+		strict:       config.StrictTemplates,
+		remoteStates: make(map[string]*RemoteState),
 	}
 
-	// Update state function to track failures
-	templater.funcMap["state"] = stateFuncWithTracking(config, stacks, executor, templater.failedDeps)
+	// state falls back to remote state for provider values, then to mocks,
+	// output is state for the current stack
+	state := templater.strictState(templater.mockState(stacks, templater.remoteState(stateFunc(config, stacks, executor))))
+	templater.funcMap["state"] = state
+	templater.funcMap["output"] = templater.outputFunc(stack.Name, state)
 
 	return templater, nil
 }
 
-func (t *Templater) Map(src any, data any) (map[string]interface{}, error) {
+// Map templates the values of src, path is the location of src in the
+// component (inputs, providers, backend.config) used to report failures
+func (t *Templater) Map(path string, src any, data any) (map[string]interface{}, error) {
 	dst := make(map[string]interface{})
 
-	err := t.Execute(src, &dst, data)
+	err := t.Execute(path, src, &dst, data)
 	if err != nil {
 		return nil, err
 	}
@@ -64,19 +111,20 @@ func (t *Templater) Map(src any, data any) (map[string]interface{}, error) {
 }
 
 func (t *Templater) Any(v any, data any) error {
-	return t.Execute(v, &v, data)
+	return t.Execute("", v, &v, data)
 }
 
-func (t *Templater) Execute(src any, dst any, data any) error {
+// Execute templates every string in src on its own and decodes the result
+// into dst, a string holding a single expression is replaced by the typed
+// value of the expression
+func (t *Templater) Execute(path string, src any, dst any, data any) error {
 	jb, err := json.Marshal(src)
 	if err != nil {
 		return err
 	}
 
-	// remove escaped quotes
-	js := strings.ReplaceAll(string(jb), `\"`, `"`)
-
-	tmpl, err := template.New("t").Funcs(t.funcMap).Parse(js)
+	var val any
+	err = json.Unmarshal(jb, &val)
 	if err != nil {
 		return err
 	}
@@ -88,64 +136,295 @@ func (t *Templater) Execute(src any, dst any, data any) error {
 		}
 	}
 
-	var b bytes.Buffer
-	err = tmpl.Execute(&b, t.data)
+	val, err = t.walk(path, val)
 	if err != nil {
 		return err
 	}
 
-	err = json.Unmarshal(b.Bytes(), &dst)
+	jb, err = json.Marshal(val)
 	if err != nil {
 		return err
 	}
 
+	return json.Unmarshal(jb, &dst)
+}
+
+// walk templates the strings of v, keys included, each template is named
+// by its JSON path so failures point at the value
+func (t *Templater) walk(path string, v any) (any, error) {
+	switch tv := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(tv))
+		for k := range tv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		res := make(map[string]interface{}, len(tv))
+		for _, k := range keys {
+			p := k
+			if !jsonKeyRe.MatchString(k) {
+				p = "[" + strconv.Quote(k) + "]"
+			} else if len(path) > 0 {
+				p = "." + k
+			}
+			p = path + p
+
+			key, err := t.text(p, k)
+			if err != nil {
+				return nil, err
+			}
+			res[key], err = t.walk(p, tv[k])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case []interface{}:
+		res := make([]interface{}, len(tv))
+		for i, e := range tv {
+			var err error
+			res[i], err = t.walk(fmt.Sprintf("%s[%d]", path, i), e)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case string:
+		return t.value(path, tv)
+	}
+
+	return v, nil
+}
+
+// value templates s, if s is exactly one {{ }} expression the typed result
+// of the expression is returned, so lists, maps, numbers and bools keep
+// their type
+func (t *Templater) value(name, s string) (any, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+
+	var res any
+	typed := template.FuncMap{
+		"__typed": func(v any) string {
+			res = v
+			return ""
+		},
+	}
+	tmpl, err := t.parse(name, s, typed)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mocking = false
+	pipe := singleExpr(tmpl)
+	if pipe == nil {
+		res, err := t.execute(tmpl)
+		if err != nil {
+			return nil, err
+		}
+		t.track(name)
+		return res, nil
+	}
+
+	// pipe the result into __typed, which captures it and renders nothing
+	cmd := &parse.CommandNode{NodeType: parse.NodeCommand, Pos: pipe.Pos}
+	cmd.Args = []parse.Node{parse.NewIdentifier("__typed").SetTree(tmpl.Tree).SetPos(pipe.Pos)}
+	pipe.Cmds = append(pipe.Cmds, cmd)
+
+	_, err = t.execute(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	t.track(name)
+
+	switch res.(type) {
+	case nil:
+		// keep the text/template rendering of missing values
+		return "<no value>", nil
+	case string:
+		return res, nil
+	}
+
+	// normalize to JSON types, values that can't be encoded stay text
+	jb, err := json.Marshal(res)
+	if err != nil {
+		return fmt.Sprint(res), nil
+	}
+	var v any
+	err = json.Unmarshal(jb, &v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// text templates s to a string
+func (t *Templater) text(name, s string) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+
+	tmpl, err := t.parse(name, s, nil)
+	if err != nil {
+		return "", err
+	}
+	return t.execute(tmpl)
+}
+
+func (t *Templater) execute(tmpl *template.Template) (string, error) {
+	var b bytes.Buffer
+	err := tmpl.Execute(&b, t.data)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func (t *Templater) parse(name, text string, funcs template.FuncMap) (*template.Template, error) {
+	tmpl := template.New(name).Funcs(t.funcMap).Funcs(funcs)
+	if t.strict {
+		tmpl = tmpl.Option("missingkey=error")
+	}
+	return tmpl.Parse(text)
+}
+
+// singleExpr returns the pipeline of a template that consists of exactly
+// one {{ }} action, or nil
+func singleExpr(tmpl *template.Template) *parse.PipeNode {
+	if tmpl.Tree == nil || len(tmpl.Tree.Root.Nodes) != 1 {
+		return nil
+	}
+
+	action, ok := tmpl.Tree.Root.Nodes[0].(*parse.ActionNode)
+	if !ok || len(action.Pipe.Decl) > 0 {
+		return nil
+	}
+
+	return action.Pipe
+}
+
+// track records the value at path when it read mock outputs
+func (t *Templater) track(path string) {
+	if t.mocking {
+		t.mocked = append(t.mocked, path)
+	}
+}
+
+// CheckMockOps fails on mock_outputs_allowed operations that can't use mock
+// outputs, like apply, or that don't exist
+func CheckMockOps(ops []string) error {
+	for _, op := range ops {
+		if !slices.Contains(mockOps, op) {
+			return fmt.Errorf(errMockOp, op, strings.Join(mockOps, ", "))
+		}
+	}
 	return nil
 }
 
-func stateFunc(config *Config, stacks *Stacks, executor Executor) func(stack, component string) any {
-	return func(stack, component string) any {
+// mockState returns the mock outputs of a component that has no outputs yet,
+// when the running operation allows them, only plan by default, apply never
+// uses them
+func (t *Templater) mockState(stacks *Stacks, state func(stack, component string) (any, error)) func(stack, component string) (any, error) {
+	return func(stack, component string) (any, error) {
+		res, err := state(stack, component)
+		if err != nil || res != nil {
+			return res, err
+		}
+
 		refStack, err := stacks.GetStack(stack)
 		if err != nil {
-			return nil
+			return nil, nil
 		}
-
 		refComponent, err := refStack.GetComponent(component)
-		if err != nil {
-			return nil
+		if err != nil || len(refComponent.MockOutputs) == 0 {
+			return nil, nil
 		}
 
-		err = refComponent.EnsurePath(config, false)
-		if err != nil {
-			return nil
+		if t.op == "apply" {
+			return nil, fmt.Errorf(errMockApply, stack, component)
+		}
+		allowed := refComponent.MockOutputsAllowed
+		if len(allowed) == 0 {
+			allowed = defaultMockOps
+		}
+		if !slices.Contains(allowed, t.op) {
+			return nil, nil
 		}
 
-		refState, err := executor.Output(refComponent)
-		if err != nil {
-			fmt.Println(err)
-			// Instead of returning nil, return a special marker that indicates remote state should be used
-			return map[string]string{
-				"__remote_state_component__": component,
-				"__remote_state_stack__":     stack,
-			}
+		t.mocking = true
+
+		return refComponent.MockOutputs, nil
+	}
+}
+
+// remoteState reads the outputs of a component that don't resolve from a
+// terraform_remote_state data source, for the keys in remoteKeys, the values
+// are interpolations which tofu resolves at plan time, so providers never
+// use mock outputs
+func (t *Templater) remoteState(state func(stack, component string) any) func(stack, component string) (any, error) {
+	return func(stack, component string) (any, error) {
+		res := state(stack, component)
+		if res != nil {
+			return res, nil
 		}
 
-		res := map[string]interface{}{}
-		for k, v := range refState {
-			// Unmarshal to get the actual typed value
-			var val interface{}
-			if err := json.Unmarshal(v.Value, &val); err == nil {
-				res[k] = val
-			} else {
-				res[k] = v.String()
+		keys := t.remoteKeys[Dependency{Stack: stack, Component: component}]
+		if len(keys) == 0 {
+			return nil, nil
+		}
+
+		name := hclNameRe.ReplaceAllString(stack+"_"+component, "_")
+		t.remoteStates[name] = &RemoteState{Stack: stack, Component: component}
+
+		outputs := make(map[string]interface{}, len(keys))
+		for _, k := range keys {
+			ref := "." + k
+			if !hclIdentRe.MatchString(k) {
+				ref = "[" + strconv.Quote(k) + "]"
 			}
+			outputs[k] = fmt.Sprintf("${data.terraform_remote_state.%s.outputs%s}", name, ref)
 		}
+		return outputs, nil
+	}
+}
 
-		return res
+// strictState fails when state doesn't resolve in strict mode, instead of
+// rendering <no value>
+func (t *Templater) strictState(state func(stack, component string) (any, error)) func(stack, component string) (any, error) {
+	return func(stack, component string) (any, error) {
+		res, err := state(stack, component)
+		if err != nil {
+			return nil, err
+		}
+		if res == nil && t.strict {
+			return nil, fmt.Errorf(errNoState, stack, component)
+		}
+		return res, nil
 	}
 }
 
-// Enhanced state function that tracks failed dependencies
-func stateFuncWithTracking(config *Config, stacks *Stacks, executor Executor, failedDeps map[string]string) func(stack, component string) any {
+// output "vpc" "id" is a shorthand for (state "<current stack>" "vpc").id
+func (t *Templater) outputFunc(stack string, state func(stack, component string) (any, error)) func(component, key string) (any, error) {
+	return func(component, key string) (any, error) {
+		res, err := state(stack, component)
+		if err != nil {
+			return nil, err
+		}
+
+		outputs, _ := res.(map[string]interface{})
+		v, ok := outputs[key]
+		if !ok && t.strict {
+			return nil, fmt.Errorf(errNoOutput, component, key)
+		}
+		return v, nil
+	}
+}
+
+// stateFunc returns the outputs of a component, or nil when it doesn't exist
+// or has no outputs
+func stateFunc(config *Config, stacks *Stacks, executor Executor) func(stack, component string) any {
 	return func(stack, component string) any {
 		refStack, err := stacks.GetStack(stack)
 		if err != nil {
@@ -164,9 +443,7 @@ func stateFuncWithTracking(config *Config, stacks *Stacks, executor Executor, fa
 
 		refState, err := executor.Output(refComponent)
 		if err != nil {
-			fmt.Println(err)
-			// Track this failed dependency
-			failedDeps[component] = stack
+			log.Debug("no outputs", "stack", stack, "component", component, "error", err)
 			return nil
 		}
 
@@ -0,0 +1,291 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTemplaterTyped(t *testing.T) {
+	stack := NewStack("dev.stack.js", "js")
+	stack.Name = "dev"
+	stack.Options = map[string]interface{}{"replicas": int64(3)}
+	stack.AddComponent("vpc", t.TempDir(), map[string]interface{}{}, nil)
+
+	stacks := &Stacks{}
+	stacks.AddStack(stack)
+
+	executor := &outputsExecutor{outputs: map[string]map[string]any{
+		"vpc": {"id": "vpc-123", "subnet_ids": []string{"a", "b"}, "tags": map[string]string{"env": "dev"}, "public": true},
+	}}
+
+	tmpl, err := NewTemplater(&Config{StacksDir: t.TempDir()}, stacks, executor, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := tmpl.Map("inputs", map[string]interface{}{
+		"subnets":  `{{ output "vpc" "subnet_ids" }}`,
+		"tags":     `{{ (state "dev" "vpc").tags }}`,
+		"public":   `{{ output "vpc" "public" }}`,
+		"replicas": "{{ .replicas }}",
+		"name":     `{{ output "vpc" "id" }}-{{ .stack }}`,
+		"quoted":   `say "{{ .stack }}"`,
+		"nested":   []interface{}{map[string]interface{}{"{{ .stack }}": `{{ output "vpc" "subnet_ids" }}`}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"subnets":  []interface{}{"a", "b"},
+		"tags":     map[string]interface{}{"env": "dev"},
+		"public":   true,
+		"replicas": float64(3),
+		"name":     "vpc-123-dev",
+		"quoted":   `say "dev"`,
+		"nested":   []interface{}{map[string]interface{}{"dev": []interface{}{"a", "b"}}},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("Map() = %v, want %v", res, want)
+	}
+}
+
+func TestTemplaterStrict(t *testing.T) {
+	stack := NewStack("dev.stack.js", "js")
+	stack.Name = "dev"
+	stack.AddComponent("vpc", t.TempDir(), map[string]interface{}{}, nil)
+	stack.AddComponent("dns", t.TempDir(), map[string]interface{}{}, nil)
+
+	stacks := &Stacks{}
+	stacks.AddStack(stack)
+
+	executor := &outputsExecutor{outputs: map[string]map[string]any{"vpc": {"id": "vpc-123"}}}
+	config := &Config{StacksDir: t.TempDir(), StrictTemplates: true}
+
+	tests := []struct {
+		path string
+		src  map[string]interface{}
+		want string
+	}{
+		{
+			"inputs",
+			map[string]interface{}{"a": map[string]interface{}{"b": []interface{}{"{{ .stack }}", "{{ .missing }}"}}},
+			`template: inputs.a.b[1]:1:3: executing "inputs.a.b[1]" at <.missing>: map has no entry for key "missing"`,
+		},
+		{
+			"providers",
+			map[string]interface{}{"google": map[string]interface{}{"project": `{{ (state "dev" "dns").project }}`}},
+			`providers.google.project:1:4: executing "providers.google.project" at <state "dev" "dns">: error calling state: state dev dns: the component does not exist or has no outputs`,
+		},
+		{
+			"backend.config",
+			map[string]interface{}{"my.prefix": `{{ output "vpc" "name" }}`},
+			`backend.config["my.prefix"]:1:3: executing "backend.config[\"my.prefix\"]" at <output "vpc" "name">: error calling output: output vpc name: the component has no such output`,
+		},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := NewTemplater(config, stacks, executor, "dev")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = tmpl.Map(tt.path, tt.src, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Map(%s) error = %v, want %s", tt.path, err, tt.want)
+		}
+	}
+
+	config.StrictTemplates = false
+	tmpl, _ := NewTemplater(config, stacks, executor, "dev")
+	res, err := tmpl.Map("inputs", map[string]interface{}{"v": "{{ .missing }}", "id": `{{ output "vpc" "id" }}`}, nil)
+	if err != nil || res["v"] != "<no value>" || res["id"] != "vpc-123" {
+		t.Errorf("Map() non-strict = %v, %v", res, err)
+	}
+}
+
+func TestTemplaterMocks(t *testing.T) {
+	stack := NewStack("dev.stack.js", "js")
+	stack.Name = "dev"
+	vpc := stack.AddComponent("vpc", t.TempDir(), map[string]interface{}{}, nil)
+	vpc.MockOutputs = map[string]interface{}{"id": "vpc-mock", "subnet_ids": []interface{}{"a", "b"}}
+
+	stacks := &Stacks{}
+	stacks.AddStack(stack)
+
+	executor := &outputsExecutor{}
+	src := map[string]interface{}{"name": "app", "vpc": `{{ output "vpc" "id" }}`, "subnets": `{{ output "vpc" "subnet_ids" }}`}
+
+	tmpl, _ := NewTemplater(&Config{StacksDir: t.TempDir()}, stacks, executor, "dev")
+	tmpl.op = "plan"
+	res, err := tmpl.Map("inputs", src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res["vpc"] != "vpc-mock" || !reflect.DeepEqual(res["subnets"], []interface{}{"a", "b"}) {
+		t.Errorf("Map() plan = %v", res)
+	}
+	if !reflect.DeepEqual(tmpl.mocked, []string{"inputs.subnets", "inputs.vpc"}) {
+		t.Errorf("mocked = %v", tmpl.mocked)
+	}
+
+	// only plan uses mocks by default
+	for _, op := range []string{"init", "export", "destroy"} {
+		tmpl, _ = NewTemplater(&Config{StacksDir: t.TempDir()}, stacks, executor, "dev")
+		tmpl.op = op
+		res, _ = tmpl.Map("inputs", src, nil)
+		if res["vpc"] != "<no value>" || len(tmpl.mocked) > 0 {
+			t.Errorf("Map() %s = %v, mocked = %v", op, res, tmpl.mocked)
+		}
+	}
+
+	vpc.MockOutputsAllowed = []string{"plan", "validate"}
+	tmpl, _ = NewTemplater(&Config{StacksDir: t.TempDir()}, stacks, executor, "dev")
+	tmpl.op = "validate"
+	res, _ = tmpl.Map("inputs", src, nil)
+	if res["vpc"] != "vpc-mock" {
+		t.Errorf("Map() allowed validate = %v", res)
+	}
+
+	tmpl, _ = NewTemplater(&Config{StacksDir: t.TempDir()}, stacks, executor, "dev")
+	tmpl.op = "apply"
+	_, err = tmpl.Map("inputs", src, nil)
+	if err == nil || !strings.Contains(err.Error(), "refusing to apply with its mock outputs") {
+		t.Errorf("Map() apply error = %v", err)
+	}
+}
+
+func TestCheckMockOps(t *testing.T) {
+	if err := CheckMockOps([]string{"plan", "validate", "export"}); err != nil {
+		t.Errorf("CheckMockOps() error = %v", err)
+	}
+	for _, op := range []string{"deploy", "apply"} {
+		err := CheckMockOps([]string{"plan", op})
+		if err == nil || !strings.Contains(err.Error(), op+" is not one of") {
+			t.Errorf("CheckMockOps(%s) error = %v", op, err)
+		}
+	}
+}
+
+func TestResolveVarsRemoteState(t *testing.T) {
+	stack := NewStack("dev.stack.js", "js")
+	stack.Name = "dev"
+	stack.Backend = Backend{Type: "gcs", Config: map[string]interface{}{"bucket": "tf", "prefix": "{{ .stack }}/{{ .component }}"}}
+	stack.AddComponent("vpc", t.TempDir(), map[string]interface{}{}, nil)
+	stack.AddComponent("gke", t.TempDir(), map[string]interface{}{}, nil)
+	app := stack.AddComponent("app", t.TempDir(), map[string]interface{}{"vpc": `{{ output "vpc" "id" }}`}, map[string]interface{}{
+		"kubernetes": map[string]interface{}{
+			"host":  `https://{{ (state "dev" "gke").endpoint }}`,
+			"token": `{{ (index (state "dev" "gke") "access-token") }}`,
+		},
+		"google": map[string]interface{}{"project": `{{ output "vpc" "project" }}`},
+	})
+
+	stacks := &Stacks{}
+	stacks.AddStack(stack)
+
+	executor := &outputsExecutor{outputs: map[string]map[string]any{"vpc": {"id": "vpc-123", "project": "acme"}}}
+	config := &Config{StacksDir: t.TempDir(), StrictTemplates: true}
+
+	err := app.ResolveVars(config, stacks, executor, "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"kubernetes": map[string]interface{}{
+			"host":  "https://${data.terraform_remote_state.dev_gke.outputs.endpoint}",
+			"token": `${data.terraform_remote_state.dev_gke.outputs["access-token"]}`,
+		},
+		"google": map[string]interface{}{"project": "acme"},
+	}
+	if !reflect.DeepEqual(app.Providers, want) {
+		t.Errorf("Providers = %v, want %v", app.Providers, want)
+	}
+
+	rs := app.RemoteStates["dev_gke"]
+	if len(app.RemoteStates) != 1 || rs == nil || rs.Backend.Type != "gcs" || rs.Backend.Config["prefix"] != "dev/gke" {
+		t.Errorf("RemoteStates = %v", app.RemoteStates)
+	}
+	if app.Backend.Config["prefix"] != "dev/app" {
+		t.Errorf("Backend prefix = %v", app.Backend.Config["prefix"])
+	}
+}
+
+func TestResolveVarsRemoteStateMocked(t *testing.T) {
+	stack := NewStack("dev.stack.js", "js")
+	stack.Name = "dev"
+	stack.Backend = Backend{Type: "gcs", Config: map[string]interface{}{"bucket": "tf", "prefix": "{{ .stack }}/{{ .component }}"}}
+	gke := stack.AddComponent("gke", t.TempDir(), map[string]interface{}{}, nil)
+	gke.MockOutputs = map[string]interface{}{"name": "gke-mock"}
+	app := stack.AddComponent("app", t.TempDir(), map[string]interface{}{"cluster": `{{ output "gke" "name" }}`}, map[string]interface{}{
+		"kubernetes": map[string]interface{}{"host": `{{ output "gke" "endpoint" }}`},
+	})
+
+	stacks := &Stacks{}
+	stacks.AddStack(stack)
+
+	err := app.ResolveVars(&Config{StacksDir: t.TempDir()}, stacks, &outputsExecutor{}, "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// providers read remote state even though gke has mocks
+	host := app.Providers["kubernetes"].(map[string]interface{})["host"]
+	if host != "${data.terraform_remote_state.dev_gke.outputs.endpoint}" || app.Inputs["cluster"] != "gke-mock" {
+		t.Errorf("Providers = %v, Inputs = %v", app.Providers, app.Inputs)
+	}
+	if !reflect.DeepEqual(app.Mocked, []string{"inputs.cluster"}) {
+		t.Errorf("Mocked = %v", app.Mocked)
+	}
+}
+
+func TestResolveVarsMockedApply(t *testing.T) {
+	stack := NewStack("dev.stack.js", "js")
+	stack.Name = "dev"
+	stack.Backend = Backend{Type: "gcs", Config: map[string]interface{}{"bucket": "tf"}}
+	gke := stack.AddComponent("gke", t.TempDir(), map[string]interface{}{}, nil)
+	gke.MockOutputs = map[string]interface{}{"endpoint": "mock"}
+	gke.MockOutputsAllowed = []string{"plan"}
+	app := stack.AddComponent("app", t.TempDir(), map[string]interface{}{}, map[string]interface{}{
+		"kubernetes": map[string]interface{}{"host": `{{ output "gke" "endpoint" }}`},
+	})
+	db := stack.AddComponent("db", t.TempDir(), map[string]interface{}{"host": `{{ output "gke" "endpoint" }}`}, nil)
+
+	stacks := &Stacks{}
+	stacks.AddStack(stack)
+	config := &Config{StacksDir: t.TempDir()}
+
+	// provider references resolve through remote state, apply doesn't refuse them
+	err := app.ResolveVars(config, stacks, &outputsExecutor{}, "apply")
+	if err != nil {
+		t.Fatalf("ResolveVars() apply with provider reference error = %v", err)
+	}
+	host := app.Providers["kubernetes"].(map[string]interface{})["host"]
+	if host != "${data.terraform_remote_state.dev_gke.outputs.endpoint}" || len(app.Mocked) > 0 {
+		t.Errorf("Providers = %v, Mocked = %v", app.Providers, app.Mocked)
+	}
+
+	err = db.ResolveVars(config, stacks, &outputsExecutor{}, "apply")
+	if err == nil || !strings.Contains(err.Error(), "refusing to apply with its mock outputs") {
+		t.Errorf("ResolveVars() apply with input reference error = %v", err)
+	}
+}
+
+func TestOutputRefs(t *testing.T) {
+	refs := OutputRefs("dev", map[string]interface{}{
+		"a": `{{ (state "shared" "dns").zone }}-{{ (state "shared" "dns").name }}`,
+		"b": `{{ (index (state "dev" "gke") "ca-cert") | b64dec }}`,
+		"c": `{{ output "vpc" "id" }}`,
+	})
+
+	want := map[Dependency][]string{
+		{Stack: "shared", Component: "dns"}: {"zone", "name"},
+		{Stack: "dev", Component: "gke"}:    {"ca-cert"},
+		{Stack: "dev", Component: "vpc"}:    {"id"},
+	}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("OutputRefs() = %v, want %v", refs, want)
+	}
+}
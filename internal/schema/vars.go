@@ -0,0 +1,102 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/template"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/moonwalker/comet/internal/log"
+)
+
+// LoadVarsFiles reads the vars files of a stack and merges them in order,
+// so later files override earlier ones. Paths are templates with the stack
+// name available as {{ .stack }}, files that don't exist are skipped so
+// per-stack overrides are optional.
+func LoadVarsFiles(files []string, stack string) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+
+	for _, f := range files {
+		tmpl, err := template.New("vars_files").Parse(f)
+		if err != nil {
+			return nil, fmt.Errorf("vars_files %s: %w", f, err)
+		}
+
+		var b bytes.Buffer
+		err = tmpl.Execute(&b, map[string]string{"stack": stack})
+		if err != nil {
+			return nil, fmt.Errorf("vars_files %s: %w", f, err)
+		}
+		path := b.String()
+
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			log.Debug("vars file not found, skipping", "path", path, "stack", stack)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := ParseVars(data)
+		if err != nil {
+			return nil, fmt.Errorf("vars file %s: %w", path, err)
+		}
+
+		vars = MergeVars(vars, v)
+	}
+
+	return vars, nil
+}
+
+// ParseVars parses a YAML or JSON document that must be an object
+func ParseVars(data []byte) (map[string]interface{}, error) {
+	jb, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var v any
+	err = json.Unmarshal(jb, &v)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("vars must be an object, got %T", v)
+	}
+
+	return m, nil
+}
+
+// MergeVars deep-merges src into dst and returns dst. Nested objects are
+// merged, any other value in src replaces the one in dst. src is never
+// modified and nothing in it is shared with dst.
+func MergeVars(dst, src map[string]interface{}) map[string]interface{} {
+	if dst == nil {
+		dst = map[string]interface{}{}
+	}
+
+	for k, v := range src {
+		sm, srcIsMap := v.(map[string]interface{})
+		dm, dstIsMap := dst[k].(map[string]interface{})
+
+		switch {
+		case srcIsMap && dstIsMap:
+			dst[k] = MergeVars(dm, sm)
+		case srcIsMap:
+			dst[k] = MergeVars(nil, sm)
+		default:
+			dst[k] = v
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,79 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadVarsFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "common.yaml"), []byte("size:\n  nodes: 3\n  machine: e2-small\nallow: [a, b]\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "prod.json"), []byte(`{"size": {"nodes": 6}, "allow": ["c"]}`), 0644)
+
+	files := []string{filepath.Join(dir, "common.yaml"), filepath.Join(dir, "{{ .stack }}.json")}
+
+	vars, err := LoadVarsFiles(files, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size := vars["size"].(map[string]interface{})
+	if size["nodes"] != float64(6) || size["machine"] != "e2-small" {
+		t.Errorf("size = %v, want nodes from prod and machine from common", size)
+	}
+	if allow := vars["allow"].([]interface{}); len(allow) != 1 || allow[0] != "c" {
+		t.Errorf("allow = %v, want lists replaced", allow)
+	}
+
+	// stacks without an override file only get the common values
+	vars, err = LoadVarsFiles(files, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars["size"].(map[string]interface{})["nodes"] != float64(3) {
+		t.Errorf("dev size = %v", vars["size"])
+	}
+
+	os.WriteFile(filepath.Join(dir, "bad.yaml"), []byte("- a\n- b\n"), 0644)
+	if _, err := LoadVarsFiles([]string{filepath.Join(dir, "bad.yaml")}, "dev"); err == nil {
+		t.Error("LoadVarsFiles() with a list error = nil")
+	}
+}
+
+func TestMergeVarsDoesNotShare(t *testing.T) {
+	src := map[string]interface{}{"db": map[string]interface{}{"tier": "small"}}
+
+	dst := MergeVars(nil, src)
+	MergeVars(dst, map[string]interface{}{"db": map[string]interface{}{"tier": "large"}})
+
+	if src["db"].(map[string]interface{})["tier"] != "small" {
+		t.Error("MergeVars() modified src")
+	}
+}
+
+func TestTemplaterVars(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "common.yaml"), []byte("region: eu\nsize: small\n"), 0644)
+
+	stack := NewStack("dev.stack.js", "js")
+	stack.Name = "dev"
+	stack.Options = map[string]interface{}{"size": "large"}
+
+	stacks := &Stacks{}
+	stacks.AddStack(stack)
+
+	config := &Config{StacksDir: dir, VarsFiles: []string{filepath.Join(dir, "common.yaml")}}
+	tmpl, err := NewTemplater(config, stacks, nil, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := tmpl.Map("inputs", map[string]interface{}{"v": "{{ .region }}-{{ .size }}-{{ .stack }}"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res["v"] != "eu-large-dev" {
+		t.Errorf("v = %v, want eu-large-dev", res["v"])
+	}
+}
@@ -0,0 +1,118 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/go-version"
+)
+
+const (
+	errVersions   = "versions: %w"
+	errConstraint = "versions: invalid tofu constraint %q: %w"
+	errTofu       = "%s %s does not satisfy the version constraint %s of %s/%s"
+)
+
+type (
+	// Versions pins the tofu version and the providers of components, it is
+	// written to the required_version and required_providers of terraform
+	Versions struct {
+		Tofu      string                      `json:"tofu,omitempty"`      // version constraint, e.g. >= 1.8
+		Providers map[string]*ProviderVersion `json:"providers,omitempty"` // by provider local name
+	}
+
+	ProviderVersion struct {
+		Source  string `json:"source,omitempty"`
+		Version string `json:"version,omitempty"`
+	}
+)
+
+// ParseVersions converts the versions() argument of a stack file
+func ParseVersions(v any) (*Versions, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	jb, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf(errVersions, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(jb))
+	dec.DisallowUnknownFields()
+
+	res := &Versions{}
+	err = dec.Decode(res)
+	if err != nil {
+		return nil, fmt.Errorf(errVersions, err)
+	}
+
+	if len(res.Tofu) > 0 {
+		_, err = version.NewConstraint(res.Tofu)
+		if err != nil {
+			return nil, fmt.Errorf(errConstraint, res.Tofu, err)
+		}
+	}
+
+	return res, nil
+}
+
+// Merge returns v with o on top, both tofu constraints apply and the
+// providers of o override the source and version of the same providers in v
+func (v *Versions) Merge(o *Versions) *Versions {
+	if v == nil {
+		return o
+	}
+	if o == nil {
+		return v
+	}
+
+	res := &Versions{Tofu: v.Tofu, Providers: map[string]*ProviderVersion{}}
+	if len(o.Tofu) > 0 {
+		if len(res.Tofu) > 0 {
+			res.Tofu += ", " + o.Tofu
+		} else {
+			res.Tofu = o.Tofu
+		}
+	}
+
+	for name, p := range v.Providers {
+		pv := *p
+		res.Providers[name] = &pv
+	}
+	for name, p := range o.Providers {
+		pv, ok := res.Providers[name]
+		if !ok {
+			pv = &ProviderVersion{}
+			res.Providers[name] = pv
+		}
+		if len(p.Source) > 0 {
+			pv.Source = p.Source
+		}
+		if len(p.Version) > 0 {
+			pv.Version = p.Version
+		}
+	}
+
+	return res
+}
+
+// CheckTofu fails when the version of the tf command doesn't satisfy the
+// tofu constraint of the component
+func (c *Component) CheckTofu(command string, v *version.Version) error {
+	if c.Versions == nil || len(c.Versions.Tofu) == 0 {
+		return nil
+	}
+
+	constraints, err := version.NewConstraint(c.Versions.Tofu)
+	if err != nil {
+		return fmt.Errorf(errConstraint, c.Versions.Tofu, err)
+	}
+
+	if !constraints.Check(v) {
+		return fmt.Errorf(errTofu, command, v, c.Versions.Tofu, c.Stack, c.Name)
+	}
+
+	return nil
+}
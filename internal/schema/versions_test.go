@@ -0,0 +1,69 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-version"
+)
+
+func TestVersionsMerge(t *testing.T) {
+	stack, err := ParseVersions(map[string]interface{}{
+		"tofu": ">= 1.8",
+		"providers": map[string]interface{}{
+			"google": map[string]interface{}{"source": "hashicorp/google", "version": "~> 6.0"},
+			"random": map[string]interface{}{"source": "hashicorp/random"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	component := &Versions{Tofu: "< 2.0", Providers: map[string]*ProviderVersion{"google": {Version: "~> 6.10"}}}
+
+	got := stack.Merge(component)
+	want := &Versions{Tofu: ">= 1.8, < 2.0", Providers: map[string]*ProviderVersion{
+		"google": {Source: "hashicorp/google", Version: "~> 6.10"},
+		"random": {Source: "hashicorp/random"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Merge() = %+v, want %+v", got, want)
+	}
+	if stack.Providers["google"].Version != "~> 6.0" {
+		t.Error("Merge() changed the stack versions")
+	}
+
+	var none *Versions
+	if none.Merge(component) != component || component.Merge(nil) != component {
+		t.Error("Merge() with nil versions")
+	}
+}
+
+func TestParseVersionsErrors(t *testing.T) {
+	tests := map[string]any{
+		"unknown field": map[string]interface{}{"terraform": ">= 1.0"},
+		"invalid":       map[string]interface{}{"tofu": "latest"},
+	}
+
+	for name, v := range tests {
+		_, err := ParseVersions(v)
+		if err == nil || !strings.HasPrefix(err.Error(), "versions:") {
+			t.Errorf("%s: error = %v", name, err)
+		}
+	}
+}
+
+func TestCheckTofu(t *testing.T) {
+	c := &Component{Stack: "dev", Name: "vpc", Versions: &Versions{Tofu: ">= 1.8, < 2.0"}}
+
+	err := c.CheckTofu("tofu", version.Must(version.NewVersion("1.8.3")))
+	if err != nil {
+		t.Errorf("CheckTofu(1.8.3) error = %v", err)
+	}
+
+	err = c.CheckTofu("tofu", version.Must(version.NewVersion("1.6.2")))
+	want := "tofu 1.6.2 does not satisfy the version constraint >= 1.8, < 2.0 of dev/vpc"
+	if err == nil || err.Error() != want {
+		t.Errorf("CheckTofu(1.6.2) error = %v, want %s", err, want)
+	}
+}
@@ -0,0 +1,177 @@
+package secrets
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	agePrefix = "age://"
+
+	errAgeIdentity = "age: no identity found\n\nℹ️  Hint: Age key might be missing. Try running:\n  comet bootstrap\n\nOr set the key manually:\n  export SOPS_AGE_KEY=\"...\""
+	errAgeKey      = "age: path '%s' not found in %s"
+)
+
+func init() {
+	Register(agePrefix, ProviderFunc(ageData))
+}
+
+// ageData decrypts age://path/to/file.age, the whole file without trailing
+// newlines, or the value at #json/path of a JSON file
+func ageData(ref string) (string, error) {
+	if !strings.HasPrefix(ref, agePrefix) {
+		return "", fmt.Errorf(opInvalidRef, agePrefix)
+	}
+
+	path, frag, _ := strings.Cut(strings.TrimPrefix(ref, agePrefix), "#")
+
+	identities, err := AgeIdentities()
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	if head, _ := r.(*bufio.Reader).Peek(len(armor.Header)); string(head) == armor.Header {
+		r = armor.NewReader(r)
+	}
+
+	dr, err := age.Decrypt(r, identities...)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+	b, err := io.ReadAll(dr)
+	if err != nil {
+		return "", err
+	}
+
+	frag, _ = strings.CutPrefix(frag, "/")
+	if len(frag) == 0 {
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+
+	res := gjson.GetBytes(b, strings.ReplaceAll(frag, "/", "."))
+	if !res.Exists() {
+		return "", fmt.Errorf(errAgeKey, frag, path)
+	}
+
+	return res.String(), nil
+}
+
+// AgeIdentities returns the age identities SOPS decrypts with, from
+// SOPS_AGE_KEY, SOPS_AGE_KEY_FILE and the key file at AgeKeyPath
+func AgeIdentities() ([]age.Identity, error) {
+	var res []age.Identity
+
+	if key := os.Getenv("SOPS_AGE_KEY"); len(key) > 0 {
+		ids, err := age.ParseIdentities(strings.NewReader(key))
+		if err != nil {
+			return nil, fmt.Errorf("SOPS_AGE_KEY: %w", err)
+		}
+		res = append(res, ids...)
+	}
+
+	for _, path := range []string{os.Getenv("SOPS_AGE_KEY_FILE"), AgeKeyPath()} {
+		if len(path) == 0 {
+			continue
+		}
+		b, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids, err := age.ParseIdentities(strings.NewReader(string(b)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		res = append(res, ids...)
+	}
+
+	if len(res) == 0 {
+		return nil, errors.New(errAgeIdentity)
+	}
+
+	return res, nil
+}
+
+// AgeEncrypt encrypts r to w for the recipients, or for the identities of
+// AgeIdentities without recipients, armored writes the PEM-like text format
+func AgeEncrypt(w io.Writer, r io.Reader, recipients []string, armored bool) error {
+	var rs []age.Recipient
+	if len(recipients) > 0 {
+		parsed, err := age.ParseRecipients(strings.NewReader(strings.Join(recipients, "\n")))
+		if err != nil {
+			return err
+		}
+		rs = parsed
+	} else {
+		identities, err := AgeIdentities()
+		if err != nil {
+			return err
+		}
+		for _, id := range identities {
+			if x, ok := id.(*age.X25519Identity); ok {
+				rs = append(rs, x.Recipient())
+			}
+		}
+	}
+
+	var aw io.WriteCloser
+	if armored {
+		aw = armor.NewWriter(w)
+		w = aw
+	}
+
+	ew, err := age.Encrypt(w, rs...)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(ew, r)
+	if err != nil {
+		return err
+	}
+	err = ew.Close()
+	if err != nil || aw == nil {
+		return err
+	}
+
+	return aw.Close()
+}
+
+// AgeKeyPath returns the default SOPS age key path for the current platform,
+// where bootstrap writes age keys
+func AgeKeyPath() string {
+	// Check if XDG_CONFIG_HOME is set
+	if xdgConfigHome := os.Getenv("XDG_CONFIG_HOME"); xdgConfigHome != "" {
+		return filepath.Join(xdgConfigHome, "sops", "age", "keys.txt")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		// Fallback to a reasonable default
+		return "~/.config/sops/age/keys.txt"
+	}
+
+	if runtime.GOOS == "darwin" {
+		return filepath.Join(home, "Library", "Application Support", "sops", "age", "keys.txt")
+	}
+
+	return filepath.Join(home, ".config", "sops", "age", "keys.txt")
+}
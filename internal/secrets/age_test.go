@@ -0,0 +1,131 @@
+package secrets
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+// ageIdentity sets SOPS_AGE_KEY to a new identity, with no default key file
+func ageIdentity(t *testing.T) *age.X25519Identity {
+	t.Helper()
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("SOPS_AGE_KEY_FILE", "")
+	t.Setenv("SOPS_AGE_KEY", id.String())
+	return id
+}
+
+func ageFile(t *testing.T, contents string, armored bool) string {
+	t.Helper()
+
+	var b bytes.Buffer
+	err := AgeEncrypt(&b, strings.NewReader(contents), nil, armored)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "secret.age")
+	os.WriteFile(path, b.Bytes(), 0600)
+	return path
+}
+
+func TestAgeData(t *testing.T) {
+	ageIdentity(t)
+
+	token := ageFile(t, "s3cret\n", false)
+	db := ageFile(t, `{"database": {"password": "pw", "port": 5432}}`, true)
+
+	tests := map[string]string{
+		"age://" + token:                     "s3cret",
+		"age://" + db + "#database/password": "pw",
+		"age://" + db + "#/database/port":    "5432",
+	}
+
+	for ref, want := range tests {
+		got, err := Get(ref)
+		if err != nil || got != want {
+			t.Errorf("Get(%s) = %s, %v, want %s", ref, got, err, want)
+		}
+	}
+
+	_, err := Get("age://" + db + "#database/user")
+	if err == nil || !strings.Contains(err.Error(), "path 'database/user' not found") {
+		t.Errorf("missing path error = %v", err)
+	}
+
+	// another identity can't decrypt
+	ageIdentity(t)
+	_, err = Get("age://" + token)
+	if err == nil || !strings.Contains(err.Error(), "failed to decrypt") {
+		t.Errorf("wrong identity error = %v", err)
+	}
+}
+
+func TestAgeIdentities(t *testing.T) {
+	id := ageIdentity(t)
+	t.Setenv("SOPS_AGE_KEY", "")
+
+	_, err := AgeIdentities()
+	if err == nil || !strings.HasPrefix(err.Error(), "age: no identity found") {
+		t.Errorf("no identity error = %v", err)
+	}
+
+	// the key file bootstrap writes
+	path := AgeKeyPath()
+	os.MkdirAll(filepath.Dir(path), 0700)
+	os.WriteFile(path, []byte("# public key: "+id.Recipient().String()+"\n"+id.String()+"\n"), 0600)
+
+	ids, err := AgeIdentities()
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("AgeIdentities() = %v, %v", ids, err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "keys.txt")
+	other, _ := age.GenerateX25519Identity()
+	os.WriteFile(keyFile, []byte(other.String()), 0600)
+	t.Setenv("SOPS_AGE_KEY_FILE", keyFile)
+
+	ids, err = AgeIdentities()
+	if err != nil || len(ids) != 2 {
+		t.Errorf("AgeIdentities() = %v, %v, want 2 identities", ids, err)
+	}
+}
+
+func TestAgeEncryptRecipients(t *testing.T) {
+	ageIdentity(t)
+	other, _ := age.GenerateX25519Identity()
+
+	var b bytes.Buffer
+	err := AgeEncrypt(&b, strings.NewReader("value"), []string{other.Recipient().String()}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "value.age")
+	os.WriteFile(path, b.Bytes(), 0600)
+
+	_, err = Get("age://" + path)
+	if err == nil {
+		t.Error("decrypted without the recipient identity")
+	}
+
+	t.Setenv("SOPS_AGE_KEY", other.String())
+	got, err := Get("age://" + path)
+	if err != nil || got != "value" {
+		t.Errorf("Get() = %s, %v, want value", got, err)
+	}
+
+	err = AgeEncrypt(&b, strings.NewReader("value"), []string{"invalid"}, false)
+	if err == nil {
+		t.Error("invalid recipient, want error")
+	}
+}
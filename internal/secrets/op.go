@@ -20,6 +20,10 @@ var (
 	opOnceErr error
 )
 
+func init() {
+	Register(opPrefix, ProviderFunc(opResolve))
+}
+
 func opResolve(ref string) (string, error) {
 	if !strings.HasPrefix(ref, opPrefix) {
 		return "", fmt.Errorf(opInvalidRef, opPrefix)
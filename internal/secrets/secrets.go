@@ -10,14 +10,55 @@ var (
 	opInvalidRef = "invalid reference, must start with '%s'"
 )
 
-func Get(ref string) (string, error) {
-	if strings.HasPrefix(ref, opPrefix) {
-		return opResolve(ref)
+type (
+	// Provider resolves the secret references starting with the prefix it is
+	// registered with, e.g. vault://
+	Provider interface {
+		Resolve(ref string) (string, error)
 	}
 
-	if strings.HasPrefix(ref, sopsPrefix) {
-		return sopsData(ref)
+	// ProviderFunc is a Provider of a single function
+	ProviderFunc func(ref string) (string, error)
+)
+
+var (
+	providers = map[string]Provider{}
+)
+
+func (f ProviderFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+// Register adds the provider of references starting with prefix, providers
+// register themselves in init
+func Register(prefix string, p Provider) {
+	providers[prefix] = p
+}
+
+// IsRef reports whether v is a reference of a registered provider
+func IsRef(v string) bool {
+	_, ok := provider(v)
+	return ok
+}
+
+func Get(ref string) (string, error) {
+	p, ok := provider(ref)
+	if !ok {
+		return "", fmt.Errorf(errNoHandler, ref)
 	}
 
-	return "", fmt.Errorf(errNoHandler, ref)
+	return p.Resolve(ref)
+}
+
+// provider returns the provider with the longest prefix of ref, so
+// overlapping prefixes don't depend on the map order
+func provider(ref string) (Provider, bool) {
+	var res Provider
+	longest := -1
+	for prefix, p := range providers {
+		if strings.HasPrefix(ref, prefix) && len(prefix) > longest {
+			res, longest = p, len(prefix)
+		}
+	}
+	return res, res != nil
 }
@@ -17,6 +17,10 @@ var (
 	yamlExts   = []string{".yaml", ".yml"}
 )
 
+func init() {
+	Register(sopsPrefix, ProviderFunc(sopsData))
+}
+
 func sopsData(ref string) (string, error) {
 	if !strings.HasPrefix(ref, sopsPrefix) {
 		return "", fmt.Errorf(opInvalidRef, sopsPrefix)
@@ -0,0 +1,145 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	vaultPrefix       = "vault://"
+	vaultAppRoleMount = "approle"
+
+	vaultInvalidRef = "invalid reference, must be vault://mount/path#key"
+	errVaultAuth    = "vault: set VAULT_TOKEN, or VAULT_ROLE_ID and VAULT_SECRET_ID for AppRole auth"
+	errVaultLogin   = "vault: approle login: %w"
+	errVaultKey     = "vault: key '%s' not found in %s"
+)
+
+// vaultProvider reads keys of KV v2 secrets, the client is configured by the
+// VAULT_* env vars of the vault cli (VAULT_ADDR, VAULT_NAMESPACE, VAULT_CACERT,
+// ...) and authenticates with VAULT_TOKEN, or with VAULT_ROLE_ID and
+// VAULT_SECRET_ID at the AppRole mount in VAULT_APPROLE_MOUNT
+type vaultProvider struct {
+	mu     sync.Mutex
+	client *vault.Client // only set once authenticated, failures are retried
+}
+
+func init() {
+	Register(vaultPrefix, &vaultProvider{})
+}
+
+// Resolve returns the key of the secret, a path into the secret data like
+// sops://, or the whole secret data as JSON without a key
+func (p *vaultProvider) Resolve(ref string) (string, error) {
+	mount, path, key, err := vaultRef(ref)
+	if err != nil {
+		return "", err
+	}
+
+	client, err := p.getClient()
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := client.KVv2(mount).Get(context.Background(), path)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+
+	b, err := json.Marshal(secret.Data)
+	if err != nil {
+		return "", err
+	}
+	if len(key) == 0 {
+		return string(b), nil
+	}
+
+	res := gjson.GetBytes(b, strings.ReplaceAll(key, "/", "."))
+	if !res.Exists() {
+		return "", fmt.Errorf(errVaultKey, key, mount+"/"+path)
+	}
+
+	return res.String(), nil
+}
+
+// vaultRef splits vault://mount/path#key
+func vaultRef(ref string) (mount, path, key string, err error) {
+	if !strings.HasPrefix(ref, vaultPrefix) {
+		return "", "", "", fmt.Errorf(opInvalidRef, vaultPrefix)
+	}
+
+	ref, key, _ = strings.Cut(strings.TrimPrefix(ref, vaultPrefix), "#")
+	mount, path, _ = strings.Cut(ref, "/")
+	if len(mount) == 0 || len(path) == 0 {
+		return "", "", "", errors.New(vaultInvalidRef)
+	}
+
+	key, _ = strings.CutPrefix(key, "/")
+	return mount, path, key, nil
+}
+
+// getClient returns the authenticated client, creating it on first use
+func (p *vaultProvider) getClient() (*vault.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client != nil {
+		return p.client, nil
+	}
+
+	client, err := vaultClient()
+	if err != nil {
+		return nil, err
+	}
+
+	p.client = client
+	return client, nil
+}
+
+func vaultClient() (*vault.Client, error) {
+	config := vault.DefaultConfig()
+	if config.Error != nil {
+		return nil, config.Error
+	}
+
+	// reads VAULT_TOKEN
+	client, err := vault.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	if len(client.Token()) > 0 {
+		return client, nil
+	}
+
+	roleID, secretID := os.Getenv("VAULT_ROLE_ID"), os.Getenv("VAULT_SECRET_ID")
+	if len(roleID) == 0 || len(secretID) == 0 {
+		return nil, errors.New(errVaultAuth)
+	}
+
+	mount := os.Getenv("VAULT_APPROLE_MOUNT")
+	if len(mount) == 0 {
+		mount = vaultAppRoleMount
+	}
+
+	login, err := client.Logical().Write("auth/"+mount+"/login", map[string]interface{}{
+		"role_id":   roleID,
+		"secret_id": secretID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf(errVaultLogin, err)
+	}
+	if login == nil || login.Auth == nil {
+		return nil, fmt.Errorf(errVaultLogin, errors.New("no token in response"))
+	}
+
+	client.SetToken(login.Auth.ClientToken)
+	return client, nil
+}
@@ -0,0 +1,163 @@
+package secrets
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// vaultServer answers AppRole logins and reads of secret/data/app/db
+func vaultServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut || r.Method == http.MethodPost:
+			if r.URL.Path != "/v1/auth/approle/login" {
+				http.NotFound(w, r)
+				return
+			}
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["role_id"] != "role" || body["secret_id"] != "secret" {
+				http.Error(w, `{"errors":["invalid role or secret ID"]}`, http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"auth":{"client_token":"approle-token"}}`))
+		case r.Header.Get("X-Vault-Token") != "root" && r.Header.Get("X-Vault-Token") != "approle-token":
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		case r.URL.Path == "/v1/secret/data/app/db":
+			w.Write([]byte(`{"data":{
+				"data":{"user":"admin","password":"s3cret","tls":{"ca":"pem"}},
+				"metadata":{"version":1,"created_time":"2024-01-01T00:00:00Z","deletion_time":"","destroyed":false}
+			}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("VAULT_ROLE_ID", "")
+	t.Setenv("VAULT_SECRET_ID", "")
+	t.Setenv("VAULT_APPROLE_MOUNT", "")
+	return srv
+}
+
+func TestVaultToken(t *testing.T) {
+	vaultServer(t)
+	t.Setenv("VAULT_TOKEN", "root")
+
+	p := &vaultProvider{}
+	tests := map[string]string{
+		"vault://secret/app/db#password": "s3cret",
+		"vault://secret/app/db#/user":    "admin",
+		"vault://secret/app/db#tls/ca":   "pem",
+	}
+
+	for ref, want := range tests {
+		got, err := p.Resolve(ref)
+		if err != nil || got != want {
+			t.Errorf("Resolve(%s) = %s, %v, want %s", ref, got, err, want)
+		}
+	}
+
+	got, err := p.Resolve("vault://secret/app/db")
+	if err != nil || !strings.Contains(got, `"user":"admin"`) {
+		t.Errorf("Resolve() without key = %s, %v", got, err)
+	}
+
+	_, err = p.Resolve("vault://secret/app/db#missing")
+	if err == nil || !strings.Contains(err.Error(), "key 'missing' not found") {
+		t.Errorf("missing key error = %v", err)
+	}
+
+	_, err = p.Resolve("vault://secret/app/cache#password")
+	if err == nil {
+		t.Error("missing secret, want error")
+	}
+}
+
+func TestVaultAppRole(t *testing.T) {
+	vaultServer(t)
+	t.Setenv("VAULT_ROLE_ID", "role")
+	t.Setenv("VAULT_SECRET_ID", "secret")
+
+	got, err := (&vaultProvider{}).Resolve("vault://secret/app/db#user")
+	if err != nil || got != "admin" {
+		t.Errorf("Resolve() = %s, %v, want admin", got, err)
+	}
+
+	t.Setenv("VAULT_SECRET_ID", "wrong")
+	p := &vaultProvider{}
+	_, err = p.Resolve("vault://secret/app/db#user")
+	if err == nil || !strings.Contains(err.Error(), "approle login") {
+		t.Errorf("login error = %v", err)
+	}
+
+	// a failed login is not cached, the next lookup logs in again
+	t.Setenv("VAULT_SECRET_ID", "secret")
+	got, err = p.Resolve("vault://secret/app/db#user")
+	if err != nil || got != "admin" {
+		t.Errorf("Resolve() after failed login = %s, %v, want admin", got, err)
+	}
+	t.Setenv("VAULT_SECRET_ID", "wrong")
+
+	t.Setenv("VAULT_ROLE_ID", "")
+	_, err = (&vaultProvider{}).Resolve("vault://secret/app/db#user")
+	if err == nil || err.Error() != errVaultAuth {
+		t.Errorf("no auth error = %v", err)
+	}
+}
+
+func TestVaultRef(t *testing.T) {
+	for _, ref := range []string{"vault://secret", "vault:///app#key", "vault://secret/#key"} {
+		_, _, _, err := vaultRef(ref)
+		if err == nil {
+			t.Errorf("vaultRef(%s), want error", ref)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	Register("test://", ProviderFunc(func(ref string) (string, error) {
+		return strings.TrimPrefix(ref, "test://"), nil
+	}))
+	t.Cleanup(func() { delete(providers, "test://") })
+
+	got, err := Get("test://value")
+	if err != nil || got != "value" {
+		t.Errorf("Get() = %s, %v", got, err)
+	}
+
+	for _, ref := range []string{"op://vault/item/field", "sops://secrets.enc.yaml", "vault://secret/app#key"} {
+		if !IsRef(ref) {
+			t.Errorf("IsRef(%s) = false", ref)
+		}
+	}
+	if IsRef("plain") {
+		t.Error("IsRef(plain) = true")
+	}
+
+	// the longest prefix wins over a shorter overlapping one
+	Register("test://special/", ProviderFunc(func(ref string) (string, error) {
+		return "special", nil
+	}))
+	t.Cleanup(func() { delete(providers, "test://special/") })
+	for range 20 {
+		if got, _ := Get("test://special/value"); got != "special" {
+			t.Fatalf("Get() = %s, want the longest prefix provider", got)
+		}
+	}
+	if got, _ := Get("test://other"); got != "other" {
+		t.Errorf("Get() = %s, want other", got)
+	}
+
+	_, err = Get("unknown://value")
+	if err == nil || !strings.Contains(err.Error(), "no handler found") {
+		t.Errorf("unknown prefix error = %v", err)
+	}
+}
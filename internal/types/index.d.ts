@@ -24,6 +24,9 @@
 export interface StackOptions {
   /** Custom options/settings passed to stack (accessible in templates as {{ .settings }}) */
   [key: string]: any;
+
+  /** Hooks run once around all components of the stack (optional) */
+  hooks?: Hooks;
 }
 
 /**
@@ -45,7 +48,9 @@ export interface BackendConfig {
 }
 
 /**
- * Component configuration
+ * Component configuration. The comet options hooks, protect, labels, enabled,
+ * mock_outputs, mock_outputs_allowed, versions and generate are only read
+ * together with inputs, in the flat config form they are module inputs
  */
 export interface ComponentConfig {
   /** Input variables for the component */
@@ -60,6 +65,112 @@ export interface ComponentConfig {
   inputs?: {
     [key: string]: any;
   };
+
+  /** Hooks run around operations on this component (optional) */
+  hooks?: Hooks;
+
+  /** Refuse to destroy the component or apply plans that delete or replace its resources (optional) */
+  protect?: boolean;
+
+  /** Labels matched by -l selectors (optional) */
+  labels?: { [key: string]: string | number | boolean };
+
+  /** Whether the component is run, or a predicate called with the stack (optional, defaults to true) */
+  enabled?: boolean | ((stack: Stack) => boolean);
+
+  /** Outputs returned by state while the component has no outputs yet, never used by apply (optional) */
+  mock_outputs?: { [key: string]: any };
+
+  /** Operations that may use mock_outputs (optional, defaults to ['plan']) */
+  mock_outputs_allowed?: ('plan' | 'validate' | 'init' | 'output' | 'export' | 'destroy')[];
+
+  /** Tofu and provider versions, merged over the stack versions() (optional) */
+  versions?: Versions;
+
+  /** Files written into the component directory by name, replacing stack files with the same name (optional) */
+  generate?: { [name: string]: Generate };
+}
+
+/**
+ * A file written into the component directory before init
+ */
+export interface Generate {
+  /** Path relative to the component directory */
+  path: string;
+  /** File contents, templated like inputs */
+  contents?: string;
+  /** What to do when a file not generated by comet exists, which is never replaced (optional, defaults to 'error') */
+  if_exists?: 'overwrite' | 'skip' | 'error';
+}
+
+/**
+ * Tofu version constraint and required providers, written to
+ * versions_gen_override.tf.json in the component directory, which overrides
+ * the required_providers entries of the module per provider
+ */
+export interface Versions {
+  /** Version constraint the tf command must satisfy, e.g. '>= 1.8, < 2.0' */
+  tofu?: string;
+  /** required_providers by local name */
+  providers?: {
+    [name: string]: {
+      /** Provider source address, e.g. 'hashicorp/google' */
+      source?: string;
+      /** Version constraint, e.g. '~> 6.0' */
+      version?: string;
+    };
+  };
+}
+
+/**
+ * Context passed to hook callbacks. Shell commands get the same values as
+ * COMET_EVENT, COMET_OPERATION, COMET_STACK, COMET_COMPONENT,
+ * COMET_COMPONENT_PATH, COMET_ERROR and COMET_OUTPUT_<NAME> env vars
+ */
+export interface HookContext {
+  event: string;
+  operation: string;
+  stack: string;
+  component: string;
+  /** Working directory of the component */
+  path: string;
+  /** Current outputs of the component, empty before the first apply */
+  outputs: { [key: string]: string };
+  /** Error message, set for on_error hooks */
+  error: string;
+}
+
+/**
+ * A shell command, a callback, or either one marked optional so that a
+ * failure is logged instead of aborting the run
+ */
+export type Hook =
+  | string
+  | ((ctx: HookContext) => void)
+  | { run: string | ((ctx: HookContext) => void); optional?: boolean };
+
+/**
+ * Lifecycle hooks, each event takes a hook or a list of hooks run in order
+ *
+ * @example
+ * component('gke', 'modules/gke', {
+ *   hooks: {
+ *     after_apply: [
+ *       'gcloud container clusters get-credentials $COMET_OUTPUT_NAME',
+ *       { run: './scripts/smoke-test.sh', optional: true },
+ *     ],
+ *   },
+ * })
+ */
+export interface Hooks {
+  before_plan?: Hook | Hook[];
+  after_plan?: Hook | Hook[];
+  before_apply?: Hook | Hook[];
+  after_apply?: Hook | Hook[];
+  before_destroy?: Hook | Hook[];
+  after_destroy?: Hook | Hook[];
+  /** Run when an operation or another hook fails */
+  on_error?: Hook | Hook[];
 }
 
 /**
@@ -72,15 +183,39 @@ export interface ProviderConfig {
   [key: string]: any;
 }
 
+/**
+ * Reference to a component output, resolved when the stack runs
+ *
+ * Supports nested attributes (`vpc.network.self_link`), indexing
+ * (`vpc.subnets[0]`), string interpolation (`${vpc.id}-app`) and a few
+ * transformations rendered as template functions.
+ */
+export interface OutputRef {
+  /** Nested attribute or list element of the output */
+  [key: string]: OutputRef | any;
+  /** Split a string output: `vpc.cidr.split('/')` */
+  split(sep: string): OutputRef;
+  /** Join a list output: `vpc.zones.join(',')` */
+  join(sep: string): OutputRef;
+  /** Replace all occurrences of old with new */
+  replace(old: string, replacement: string): OutputRef;
+  /** Lowercase a string output */
+  lower(): OutputRef;
+  /** Uppercase a string output */
+  upper(): OutputRef;
+  /** Renders the template expression */
+  toString(): string;
+}
+
 /**
  * Component proxy object with dynamic property access
- * Properties return template strings referencing component outputs
+ * Inputs return their value, other properties return references to component outputs
  */
 export interface ComponentProxy {
   /** Component name */
   name: string;
-  /** Access any output from the component as a template reference */
-  [output: string]: any;
+  /** Access any output from the component as a reference */
+  [output: string]: OutputRef | any;
 }
 
 /**
@@ -211,6 +346,72 @@ export function secretsConfig(config: SecretsConfig): void;
  */
 export function secret(path: string): any;
 
+/**
+ * Read a file as a string
+ *
+ * Paths are relative to the stack file and must stay inside the repository root.
+ *
+ * @param path - File path
+ * @returns File contents
+ *
+ * @example
+ * component('vm', 'modules/vm', {
+ *   user_data: file('./cloud-init.yaml')
+ * })
+ */
+export function file(path: string): string;
+
+/**
+ * Read a file and replace `${name}` placeholders with the given variables
+ *
+ * Placeholders may use dotted paths (`${db.host}`). Go template expressions
+ * (`{{ .stack }}`) are left untouched and resolved later.
+ *
+ * @param path - Template file path
+ * @param vars - Variables to substitute
+ * @returns Rendered contents
+ *
+ * @example
+ * const policy = templatefile('./policies/bucket.json', { bucket: 'my-bucket' })
+ */
+export function templatefile(path: string, vars: { [key: string]: any }): string;
+
+/**
+ * Read and parse a YAML file
+ *
+ * @param path - YAML file path
+ * @returns Parsed value
+ *
+ * @example
+ * const sizes = yaml('./sizing.yaml')
+ */
+export function yaml(path: string): any;
+
+/**
+ * Read and parse a JSON file
+ *
+ * @param path - JSON file path
+ * @returns Parsed value
+ *
+ * @example
+ * const allowlist = json('./allowlist.json')
+ */
+export function json(path: string): any;
+
+/**
+ * Load YAML or JSON files and deep-merge them, in order, into the stack
+ * options available to templates. Later files override earlier ones, and
+ * options passed to stack() override all files, before or after the call.
+ *
+ * @param paths - Files relative to the stack file
+ * @returns Merged values
+ *
+ * @example
+ * const v = vars('./vars/common.yaml', './vars/prod.yaml')
+ * component('gke', 'modules/gke', { nodes: v.gke.nodes, machine: '{{ .gke.machine }}' })
+ */
+export function vars(...paths: string[]): any;
+
 /**
  * Define a stack with name and options
  *
@@ -252,7 +453,8 @@ export function backend(type: string, config: BackendConfig): void;
  * Define an infrastructure component
  *
  * @param name - Component name (unique within stack)
- * @param source - Path to Terraform module (relative or absolute)
+ * @param source - Path to Terraform module (relative or absolute), or a git
+ *   source like 'git::https://github.com/org/modules.git//vpc?ref=v1.4.0'
  * @param config - Component configuration (inputs and providers)
  * @returns Component proxy object for referencing outputs
  *
@@ -293,6 +495,39 @@ export function component(
  */
 export function append(type: string, lines: string[]): void;
 
+/**
+ * Pin the tofu version and provider versions of all components of the stack.
+ * Components can add constraints or override providers with their versions
+ * option, and comet checks the local tf_command before running anything.
+ *
+ * @param versions - Tofu constraint and required providers
+ *
+ * @example
+ * versions({
+ *   tofu: '>= 1.8',
+ *   providers: {
+ *     google: { source: 'hashicorp/google', version: '~> 6.0' }
+ *   }
+ * })
+ */
+export function versions(versions: Versions): void;
+
+/**
+ * Write a file into every component directory of the stack before init.
+ * Generated files are tracked in .comet-generated.json and removed by
+ * comet clean.
+ *
+ * @param name - Name of the file, components can replace it with their generate option
+ * @param options - Path, templated contents and if_exists
+ *
+ * @example
+ * generate('common', {
+ *   path: 'common_gen.tf',
+ *   contents: 'locals { environment = "{{ .stack }}" }'
+ * })
+ */
+export function generate(name: string, options: Generate): void;
+
 /**
  * Configure Kubernetes access for the stack
  *
@@ -337,6 +572,32 @@ export interface TemplateContext {
   component: string;
   /** Stack options (alias for settings) */
   opts: any;
+  /** Absolute path of the stacks directory */
+  stacks_dir: string;
+  /** Working directory of the current component */
+  component_path: string;
+  /** Backend type of the current component, e.g. 'gcs' or 's3' */
+  backend_type: string;
+  /** Version of comet running the templates, 'dev' for local builds */
+  comet_version: string;
+  /** Name of the user running comet */
+  user: string;
+  /** Commit the stacks are deployed from, empty outside of a git repository */
+  git: {
+    /** Full commit sha of HEAD */
+    sha: string;
+    /** Current branch, empty on a detached HEAD */
+    branch: string;
+    /** Whether the working tree has uncommitted changes */
+    dirty: boolean;
+  };
+  /** Stack metadata, empty values when the stack has none */
+  metadata: {
+    description: string;
+    owner: string;
+    tags: string[];
+    custom: { [key: string]: any };
+  };
 }
 
 // ============================================================================
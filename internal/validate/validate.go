@@ -0,0 +1,350 @@
+package validate
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/moonwalker/comet/internal/modules"
+	"github.com/moonwalker/comet/internal/parser"
+	"github.com/moonwalker/comet/internal/parser/js"
+	"github.com/moonwalker/comet/internal/schema"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+type (
+	// Diagnostic is a single problem found in the stacks
+	Diagnostic struct {
+		Severity  Severity `json:"severity"`
+		Check     string   `json:"check"`
+		Stack     string   `json:"stack,omitempty"`
+		Component string   `json:"component,omitempty"`
+		File      string   `json:"file,omitempty"`
+		Line      int      `json:"line,omitempty"`
+		Column    int      `json:"column,omitempty"`
+		Message   string   `json:"message"`
+	}
+
+	validator struct {
+		stacks      []*schema.Stack
+		diagnostics []*Diagnostic
+	}
+)
+
+// Run parses all stacks in dir and checks the named ones, or all of them
+// when no names are given. With names, only the files of the named stacks
+// and the stacks they reference are reported, so a broken unrelated stack
+// file doesn't fail the run. Nothing is executed against the backends.
+func Run(dir string, names []string) ([]*Diagnostic, error) {
+	stacks, fileErrs, err := parser.ParseAll(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &validator{stacks: stacks}
+
+	needed, files := v.needed(dir, names)
+
+	for _, fe := range fileErrs {
+		if needed != nil && !slices.Contains(files, filepath.Clean(fe.Path)) {
+			continue
+		}
+		v.parseError(fe)
+	}
+
+	seen := map[string]string{}
+	for _, s := range stacks {
+		if prev, ok := seen[s.Name]; ok {
+			if needed == nil || slices.Contains(needed, s.Name) {
+				v.add(&Diagnostic{Check: "parse", Stack: s.Name, File: s.Path,
+					Message: fmt.Sprintf("stack %s is already declared in %s", s.Name, prev)})
+			}
+			continue
+		}
+		seen[s.Name] = s.Path
+	}
+
+	for _, name := range names {
+		if _, ok := seen[name]; !ok {
+			v.add(&Diagnostic{Check: "parse", Stack: name, Message: fmt.Sprintf("stack not found: %s", name)})
+		}
+	}
+
+	for _, s := range stacks {
+		if len(names) > 0 && !slices.Contains(names, s.Name) {
+			continue
+		}
+		v.stack(s)
+	}
+
+	return v.diagnostics, nil
+}
+
+// needed returns the named stacks and the stacks they reference, with the
+// files declaring them, nil when no names are given
+func (v *validator) needed(dir string, names []string) ([]string, []string) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	needed := slices.Clone(names)
+	files := []string{}
+
+	for i := 0; i < len(needed); i++ {
+		if p := parser.StackFile(dir, needed[i]); len(p) > 0 {
+			files = append(files, filepath.Clean(p))
+		}
+
+		for _, s := range v.stacks {
+			if s.Name != needed[i] {
+				continue
+			}
+			files = append(files, filepath.Clean(s.Path))
+			for _, ref := range s.References() {
+				if !slices.Contains(needed, ref) {
+					needed = append(needed, ref)
+				}
+			}
+		}
+	}
+
+	return needed, files
+}
+
+// HasErrors reports whether any diagnostic is an error
+func HasErrors(diagnostics []*Diagnostic) bool {
+	return slices.ContainsFunc(diagnostics, func(d *Diagnostic) bool {
+		return d.Severity == SeverityError
+	})
+}
+
+func (d *Diagnostic) String() string {
+	sb := strings.Builder{}
+	sb.WriteString(string(d.Severity))
+
+	if len(d.File) > 0 {
+		sb.WriteString(" " + d.File)
+		if d.Line > 0 {
+			sb.WriteString(fmt.Sprintf(":%d:%d", d.Line, d.Column))
+		}
+	}
+
+	target := d.Stack
+	if len(d.Component) > 0 {
+		target += "/" + d.Component
+	}
+	if len(target) > 0 {
+		sb.WriteString(" [" + target + "]")
+	}
+
+	sb.WriteString(fmt.Sprintf(" %s: %s", d.Check, d.Message))
+	return sb.String()
+}
+
+func (v *validator) add(d *Diagnostic) {
+	if len(d.Severity) == 0 {
+		d.Severity = SeverityError
+	}
+	v.diagnostics = append(v.diagnostics, d)
+}
+
+func (v *validator) parseError(fe *parser.FileError) {
+	d := &Diagnostic{Check: "parse", File: fe.Path, Message: fe.Err.Error()}
+
+	var serr *js.ScriptError
+	if errors.As(fe.Err, &serr) {
+		d.File, d.Line, d.Column, d.Message = serr.File, serr.Line, serr.Column, serr.Message
+	}
+
+	v.add(d)
+}
+
+func (v *validator) stack(s *schema.Stack) {
+	if len(s.Backend.Type) == 0 {
+		v.add(&Diagnostic{Check: "backend", Stack: s.Name, File: s.Path, Message: "stack has no backend"})
+	}
+
+	names := map[string]bool{}
+	for _, c := range s.Components {
+		if names[c.Name] {
+			v.add(&Diagnostic{Check: "unique", Stack: s.Name, Component: c.Name, File: s.Path,
+				Message: fmt.Sprintf("component name %s is used more than once", c.Name)})
+		}
+		names[c.Name] = true
+
+		if modules.IsRemote(c.Path) {
+			if _, err := modules.ParseSource(c.Path); err != nil {
+				v.add(&Diagnostic{Check: "path", Stack: s.Name, Component: c.Name, File: s.Path, Message: err.Error()})
+			}
+		} else if _, err := os.Stat(c.Path); err != nil {
+			v.add(&Diagnostic{Check: "path", Stack: s.Name, Component: c.Name, File: s.Path,
+				Message: fmt.Sprintf("component path %s does not exist", c.Path)})
+		}
+
+		if c.Disabled {
+			continue
+		}
+		for _, dep := range c.Depends {
+			v.reference(s, c.Name, dep)
+		}
+	}
+
+	v.cycles(s)
+	v.kubeconfig(s)
+}
+
+// reference checks that a state reference points to an existing component
+func (v *validator) reference(s *schema.Stack, component string, dep schema.Dependency) {
+	d := &Diagnostic{Check: "reference", Stack: s.Name, Component: component, File: s.Path}
+
+	ref := v.find(dep.Stack)
+	if ref == nil {
+		d.Message = fmt.Sprintf("state references unknown stack %s", dep.Stack)
+		v.add(d)
+		return
+	}
+
+	c, err := ref.GetComponent(dep.Component)
+	if err != nil {
+		d.Message = fmt.Sprintf("state references unknown component %s in stack %s", dep.Component, dep.Stack)
+		v.add(d)
+		return
+	}
+
+	if c.Disabled {
+		d.Message = fmt.Sprintf("state references disabled component %s in stack %s", dep.Component, dep.Stack)
+		v.add(d)
+	}
+}
+
+// cycles reports dependency cycles reachable from the stack's components
+func (v *validator) cycles(s *schema.Stack) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+
+	state := map[schema.Dependency]int{}
+	reported := map[string]bool{}
+
+	var visit func(node schema.Dependency, path []schema.Dependency)
+	visit = func(node schema.Dependency, path []schema.Dependency) {
+		switch state[node] {
+		case done:
+			return
+		case visiting:
+			start := slices.Index(path, node)
+			cycle := make([]string, 0, len(path)-start+1)
+			for _, n := range append(path[start:], node) {
+				cycle = append(cycle, n.Stack+"/"+n.Component)
+			}
+			key := strings.Join(cycle, " -> ")
+			if !reported[key] {
+				reported[key] = true
+				v.add(&Diagnostic{Check: "cycle", Stack: s.Name, Component: node.Component, File: s.Path,
+					Message: "dependency cycle: " + key})
+			}
+			return
+		}
+
+		state[node] = visiting
+		path = append(path, node)
+
+		if c := v.component(node); c != nil {
+			for _, dep := range c.Depends {
+				visit(dep, path)
+			}
+		}
+
+		state[node] = done
+	}
+
+	for _, c := range s.Components {
+		visit(schema.Dependency{Stack: s.Name, Component: c.Name}, nil)
+	}
+}
+
+func (v *validator) kubeconfig(s *schema.Stack) {
+	k := s.Kubeconfig
+	if k == nil {
+		return
+	}
+
+	add := func(msg string) {
+		v.add(&Diagnostic{Check: "kubeconfig", Stack: s.Name, File: s.Path, Message: msg})
+	}
+
+	for _, dep := range schema.FindDependencies(s.Name, k) {
+		v.reference(s, "", dep)
+	}
+
+	if len(k.Clusters) == 0 {
+		add("kubeconfig has no clusters")
+		return
+	}
+	if k.Current < 0 || k.Current >= len(k.Clusters) {
+		add(fmt.Sprintf("current cluster index %d is out of range", k.Current))
+	}
+
+	contexts := map[string]bool{}
+	for i, c := range k.Clusters {
+		if c == nil {
+			add(fmt.Sprintf("cluster %d is empty", i))
+			continue
+		}
+		if len(c.Context) == 0 {
+			add(fmt.Sprintf("cluster %d has no context", i))
+		} else if contexts[c.Context] {
+			add(fmt.Sprintf("context %s is used by more than one cluster", c.Context))
+		}
+		contexts[c.Context] = true
+
+		if len(c.Host) == 0 {
+			add(fmt.Sprintf("cluster %s has no host", c.Context))
+		}
+		if len(c.Cert) > 0 && !isTemplate(c.Cert) {
+			if _, err := base64.StdEncoding.DecodeString(c.Cert); err != nil {
+				add(fmt.Sprintf("cluster %s cert is not valid base64", c.Context))
+			}
+		}
+		if len(c.ExecCommand) == 0 && len(c.Token) == 0 {
+			v.add(&Diagnostic{Severity: SeverityWarning, Check: "kubeconfig", Stack: s.Name, File: s.Path,
+				Message: fmt.Sprintf("cluster %s has neither exec_command nor token", c.Context)})
+		}
+	}
+}
+
+func (v *validator) find(name string) *schema.Stack {
+	for _, s := range v.stacks {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func (v *validator) component(d schema.Dependency) *schema.Component {
+	s := v.find(d.Stack)
+	if s == nil {
+		return nil
+	}
+	c, err := s.GetComponent(d.Component)
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+func isTemplate(s string) bool {
+	return strings.Contains(s, "{{")
+}
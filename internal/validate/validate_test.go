@@ -0,0 +1,155 @@
+package validate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	os.MkdirAll("modules/x", 0755)
+	files := map[string]string{
+		"ok.stack.js": `
+stack('ok', {})
+backend('local', {})
+const a = component('a', 'modules/x', {})
+component('b', 'modules/x', { id: a.id })
+`,
+		"bad.stack.js": `
+stack('bad', {})
+const a = component('a', 'modules/x', { v: '{{ (state "bad" "b").id }}' })
+const b = component('b', 'modules/missing', { v: a.id })
+component('b', 'modules/x', {})
+component('c', 'modules/x', { v: '{{ (state "nope" "x").id }}', w: '{{ (state "ok" "zz").id }}' })
+kubeconfig({ current: 3, clusters: [{ context: 'k', host: '', cert: 'not base64!', token: 't' }] })
+`,
+		"broken.stack.js": "stack('broken', {\n",
+		"off.stack.js": `
+stack('off', {})
+backend('local', {})
+const db = component('db', 'modules/x', { enabled: false, inputs: {} })
+const old = component('old', 'modules/x', { enabled: false, inputs: { db: db.id } })
+component('app', 'modules/x', { db: db.id })
+`,
+	}
+	os.MkdirAll("stacks", 0755)
+	for name, src := range files {
+		os.WriteFile(filepath.Join("stacks", name), []byte(src), 0644)
+	}
+
+	diagnostics, err := Run("stacks", nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := []string{
+		"broken.stack.js:2:1 parse:",
+		"[bad] backend: stack has no backend",
+		"[bad/b] unique: component name b is used more than once",
+		"[bad/b] path: component path modules/missing does not exist",
+		"[bad/c] reference: state references unknown stack nope",
+		"[bad/c] reference: state references unknown component zz in stack ok",
+		"cycle: dependency cycle: bad/a -> bad/b -> bad/a",
+		"kubeconfig: current cluster index 3 is out of range",
+		"kubeconfig: cluster k has no host",
+		"kubeconfig: cluster k cert is not valid base64",
+		"[off/app] reference: state references disabled component db in stack off",
+	}
+
+	got := make([]string, len(diagnostics))
+	for i, d := range diagnostics {
+		got[i] = d.String()
+		if strings.Contains(got[i], "[ok") || strings.Contains(got[i], "[off/old]") {
+			t.Errorf("unexpected diagnostic for valid stack: %s", got[i])
+		}
+	}
+
+	for _, w := range want {
+		found := false
+		for _, g := range got {
+			if strings.Contains(g, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("missing diagnostic %q in:\n%s", w, strings.Join(got, "\n"))
+		}
+	}
+
+	if !HasErrors(diagnostics) {
+		t.Error("HasErrors() = false, want true")
+	}
+
+	diagnostics, err = Run("stacks", []string{"ok"})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	for _, d := range diagnostics {
+		if d.Stack == "bad" {
+			t.Errorf("Run(ok) reported diagnostic for bad: %s", d)
+		}
+	}
+}
+
+func TestRunNamed(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	os.MkdirAll("modules/x", 0755)
+	files := map[string]string{
+		"dev.stack.js": `
+stack('dev', {})
+backend('local', {})
+component('app', 'modules/x', { vpc: '{{ (state "shared" "vpc").id }}' })
+`,
+		"network.stack.js": `
+stack('shared', {})
+backend('local', {})
+component('vpc', 'modules/x', {})
+`,
+		// a teammate's unrelated stack that doesn't parse
+		"teammate.stack.js": "stack('teammate', {\n",
+	}
+	os.MkdirAll("stacks", 0755)
+	for name, src := range files {
+		os.WriteFile(filepath.Join("stacks", name), []byte(src), 0644)
+	}
+
+	diagnostics, err := Run("stacks", []string{"dev"})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(diagnostics) > 0 {
+		t.Errorf("Run(dev) = %v, want no diagnostics", diagnostics)
+	}
+
+	// the file of a named stack is still reported when it doesn't parse
+	diagnostics, _ = Run("stacks", []string{"teammate"})
+	if len(diagnostics) != 2 || !strings.Contains(diagnostics[0].String(), "teammate.stack.js:2:1 parse:") {
+		t.Errorf("Run(teammate) = %v, want the parse error", diagnostics)
+	}
+
+	// and so is the file of a referenced stack
+	os.Remove("stacks/network.stack.js")
+	os.WriteFile("stacks/shared.stack.js", []byte("stack('shared', {\n"), 0644)
+	diagnostics, _ = Run("stacks", []string{"dev"})
+	found := false
+	for _, d := range diagnostics {
+		found = found || strings.Contains(d.String(), "shared.stack.js:2:1 parse:")
+		if strings.Contains(d.String(), "teammate") {
+			t.Errorf("Run(dev) reported the unrelated file: %s", d)
+		}
+	}
+	if !found {
+		t.Errorf("Run(dev) = %v, want the parse error of shared.stack.js", diagnostics)
+	}
+}
@@ -24,6 +24,11 @@ func init() {
 	}
 }
 
+// Version is the release of comet, dev for local builds
+func Version() string {
+	return version
+}
+
 func Info() string {
 	return fmt.Sprintf("%s, build %.7s", version, commit)
 }